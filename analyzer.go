@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ikawaha/kagome/tokenizer"
+)
+
+// dictionaries are system dictionaries and their feature layouts.
+var dictionaries = map[string]struct {
+	dic    func() tokenizer.Dic
+	layout *featureLayout
+}{
+	"ipa": {tokenizer.SysDicIPA, ipaLayout},
+	"uni": {tokenizer.SysDicUni, uniLayout},
+}
+
+// Analyzer analyzes texts into sentences. It is shared by learning and
+// replies, and reloads its user dictionary when the file is modified.
+//
+// Texts are analyzed by a pool of workers. Texts of Analyze (replies) are
+// analyzed prior to texts of JapaneseParseServer (learning).
+type Analyzer struct {
+	dic       tokenizer.Dic
+	layout    *featureLayout
+	path      string // user dictionary file. Empty means no user dictionary.
+	mu        *sync.RWMutex
+	tokenizer tokenizer.Tokenizer
+	userDic   *UserDictionary
+	modTime   time.Time
+	workers   int
+	priority  chan analysisJob // jobs of Analyze
+	jobs      chan analysisJob // jobs of JapaneseParseServer
+}
+
+// analysisJob is a text to analyze. The sentence is sent to result, which
+// must have room for it not to block the worker.
+type analysisJob struct {
+	text   string
+	result chan<- Sentence
+}
+
+// DefaultAnalyzer uses .env values. The system dictionary is TOKENIZER_DIC
+// ("ipa" or "uni") and the user dictionary is read from USER_DIC_FILE.
+// ANALYZER_WORKERS workers analyze texts.
+func DefaultAnalyzer() (*Analyzer, error) {
+	dic := os.Getenv("TOKENIZER_DIC")
+	if dic == "" {
+		dic = "ipa"
+	}
+	workers, err := envIntDefault("ANALYZER_WORKERS", runtime.NumCPU())
+	if err != nil {
+		return nil, fmt.Errorf("cannot create analyzer: %w", err)
+	}
+	analyzer, err := NewAnalyzer(dic, os.Getenv("USER_DIC_FILE"), workers)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create analyzer: %w", err)
+	}
+	return analyzer, nil
+}
+
+// NewAnalyzer returns new Analyzer with the system dictionary dic and the
+// user dictionary at path. If path is empty, no user dictionary is used.
+// If workers is less than 1, texts are analyzed in the caller's goroutine.
+func NewAnalyzer(dic, path string, workers int) (*Analyzer, error) {
+	d, ok := dictionaries[dic]
+	if !ok {
+		return nil, fmt.Errorf("unknown dictionary %q", dic)
+	}
+
+	analyzer := &Analyzer{
+		dic:      d.dic(),
+		layout:   d.layout,
+		path:     path,
+		mu:       new(sync.RWMutex),
+		workers:  workers,
+		priority: make(chan analysisJob),
+		jobs:     make(chan analysisJob),
+	}
+	analyzer.tokenizer = tokenizer.NewWithDic(analyzer.dic)
+	if _, err := analyzer.Reload(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < workers; i++ {
+		go analyzer.worker()
+	}
+	return analyzer, nil
+}
+
+// Close stops the workers. The analyzer must not be used after Close.
+func (a *Analyzer) Close() {
+	close(a.priority)
+	close(a.jobs)
+}
+
+// worker analyzes texts until the analyzer is closed.
+func (a *Analyzer) worker() {
+	for {
+		var job analysisJob
+		var ok bool
+		select {
+		case job, ok = <-a.priority:
+		default:
+			select {
+			case job, ok = <-a.priority:
+			case job, ok = <-a.jobs:
+			}
+		}
+		if !ok {
+			return
+		}
+		job.result <- a.analyze(job.text)
+	}
+}
+
+// Reload reads the user dictionary again if it is modified. If it cannot be
+// read, the current dictionary is kept.
+func (a *Analyzer) Reload() (reloaded bool, err error) {
+	if a.path == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return false, fmt.Errorf("cannot load user dictionary: %w", err)
+	}
+	a.mu.RLock()
+	modified := !info.ModTime().Equal(a.modTime)
+	a.mu.RUnlock()
+	if !modified {
+		return false, nil
+	}
+
+	userDic, err := LoadUserDictionary(a.path)
+	if err != nil {
+		return false, err
+	}
+	t := tokenizer.NewWithDic(a.dic)
+	t.SetUserDic(userDic.dic)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokenizer = t
+	a.userDic = userDic
+	a.modTime = info.ModTime()
+	return true, nil
+}
+
+// ReloadServer reloads the user dictionary every interval forever.
+func (a *Analyzer) ReloadServer(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reloaded, err := a.Reload()
+		if err != nil {
+			log.Println(err)
+		} else if reloaded {
+			log.Printf("user dictionary reloaded: %d words", a.userDic.Len())
+		}
+	}
+}
+
+// Analyze analyzes text into Sentence. It is safe for concurrent use.
+func (a *Analyzer) Analyze(text string) Sentence {
+	if a.workers < 1 {
+		return a.analyze(text)
+	}
+	result := make(chan Sentence, 1)
+	a.priority <- analysisJob{text, result}
+	return <-result
+}
+
+// analyze analyzes text with the current dictionaries.
+func (a *Analyzer) analyze(text string) Sentence {
+	a.mu.RLock()
+	t, userDic := a.tokenizer, a.userDic
+	a.mu.RUnlock()
+
+	sentence := analyzeTokens(t.Tokenize(text), a.layout)
+	if userDic != nil {
+		userDic.Apply(sentence)
+	}
+	return sentence
+}
+
+// JapaneseParseServer parses chString text and sends it to chSentence
+// forever. Texts are analyzed in parallel, so the order of sentences may
+// differ from the order of texts.
+func (a *Analyzer) JapaneseParseServer(chSentence chan<- Sentence, chString <-chan string) {
+	if a.workers < 1 {
+		for text := range chString {
+			chSentence <- a.analyze(text)
+		}
+		return
+	}
+
+	// Workers send sentences to results, and they are forwarded to
+	// chSentence, so workers never wait for chSentence and Analyze is not
+	// starved. Each job holds a slot until its sentence is forwarded, so
+	// results never becomes full.
+	results := make(chan Sentence, a.workers)
+	slots := make(chan struct{}, a.workers)
+	go func() {
+		for sentence := range results {
+			chSentence <- sentence
+			<-slots
+		}
+	}()
+
+	for text := range chString {
+		slots <- struct{}{}
+		a.jobs <- analysisJob{text, results}
+	}
+
+	// wait for all jobs to be forwarded
+	for i := 0; i < cap(slots); i++ {
+		slots <- struct{}{}
+	}
+	close(results)
+}
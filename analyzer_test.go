@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ikawaha/kagome/tokenizer"
+)
+
+func TestAnalyzer_dictionaries(t *testing.T) {
+	texts := []string{
+		"おはようございます",
+		"東京に行きたかった",
+		"ラップで勝負だぜ",
+		"今日はいい天気ですね",
+		"2020年に3本のマイクを持った",
+		"お前のライムは最高",
+		"money flow yeah",
+	}
+
+	ipa, err := NewAnalyzer("ipa", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uni, err := NewAnalyzer("uni", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, text := range texts {
+		ipaMorae, ipaOK := trimBOSEOS(ipa.Analyze(text)).Morae()
+		uniMorae, uniOK := trimBOSEOS(uni.Analyze(text)).Morae()
+		if !ipaOK || !uniOK {
+			t.Errorf("[%d] expected pronounceable, but got %v, %v", idx, ipaOK, uniOK)
+			continue
+		}
+		if ipaMorae.Katakana() != uniMorae.Katakana() {
+			t.Errorf("[%d] expected %v, but got %v", idx, ipaMorae.Katakana(), uniMorae.Katakana())
+		}
+	}
+}
+
+func TestNewAnalyzer(t *testing.T) {
+	if _, err := NewAnalyzer("jumandic", "", 0); err == nil {
+		t.Error("expected an error, but got nil")
+	}
+}
+
+func TestAnalyzer_workers(t *testing.T) {
+	texts := []string{"おはようございます", "東京に行きたかった", "2020年", "お前のライムは最高"}
+
+	direct, err := NewAnalyzer("ipa", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := NewAnalyzer("ipa", "", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	expected := map[string]Sentence{}
+	for _, text := range texts {
+		expected[text] = direct.Analyze(text)
+	}
+
+	chString := make(chan string)
+	chSentence := make(chan Sentence)
+	go pool.JapaneseParseServer(chSentence, chString)
+	go func() {
+		for i := 0; i < 100; i++ {
+			chString <- texts[i%len(texts)]
+		}
+		close(chString)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(text string) {
+			defer wg.Done()
+			if sentence := pool.Analyze(text); !reflect.DeepEqual(expected[text], sentence) {
+				t.Errorf("expected %v, but got %v", expected[text], sentence)
+			}
+		}(texts[i%len(texts)])
+	}
+
+	for i := 0; i < 100; i++ {
+		sentence := <-chSentence
+		text := trimBOSEOS(sentence).String()
+		if !reflect.DeepEqual(expected[text], sentence) {
+			t.Errorf("[%d] expected %v, but got %v", i, expected[text], sentence)
+		}
+	}
+	wg.Wait()
+}
+
+func TestAnalyzer_Analyze_blockedLearning(t *testing.T) {
+	// The pool is not closed because JapaneseParseServer keeps sending jobs.
+	pool, err := NewAnalyzer("ipa", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nobody receives sentences of learning
+	chString := make(chan string)
+	go pool.JapaneseParseServer(make(chan Sentence), chString)
+	go func() {
+		for i := 0; i < 10; i++ {
+			chString <- "おはようございます"
+		}
+	}()
+
+	done := make(chan Sentence)
+	go func() { done <- pool.Analyze("東京に行きたかった") }()
+	select {
+	case sentence := <-done:
+		if trimBOSEOS(sentence).String() != "東京に行きたかった" {
+			t.Errorf("expected %v, but got %v", "東京に行きたかった", sentence)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Analyze is blocked by learning")
+	}
+}
+
+var benchmarkTexts = []string{
+	"今日は朝からずっと雨が降っていて最悪の気分",
+	"お前のライムは最高だけど俺のフローには勝てない",
+	"2020年に3本のマイクを持ってステージに立った",
+	"東京の夜は長いから朝まで踊り明かそうぜ",
+}
+
+func BenchmarkAnalyzer_JapaneseParseServer(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			analyzer, err := NewAnalyzer("ipa", "", workers)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer analyzer.Close()
+
+			chString := make(chan string)
+			chSentence := make(chan Sentence, workers)
+			go analyzer.JapaneseParseServer(chSentence, chString)
+
+			b.ResetTimer()
+			go func() {
+				for i := 0; i < b.N; i++ {
+					chString <- benchmarkTexts[i%len(benchmarkTexts)]
+				}
+				close(chString)
+			}()
+			for i := 0; i < b.N; i++ {
+				<-chSentence
+			}
+		})
+	}
+}
+
+func BenchmarkAnalyzer_Analyze(b *testing.B) {
+	b.Run("newTokenizer", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			t := tokenizer.New()
+			analyzeText(&t, benchmarkTexts[i%len(benchmarkTexts)])
+		}
+	})
+	b.Run("sharedAnalyzer", func(b *testing.B) {
+		analyzer, err := NewAnalyzer("ipa", "", 1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer analyzer.Close()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			analyzer.Analyze(benchmarkTexts[i%len(benchmarkTexts)])
+		}
+	})
+}
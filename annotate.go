@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// LyricFormat is a format of an annotated lyric.
+type LyricFormat string
+
+const (
+	// FormatNone is not annotated. It is the same as Lyric.String().
+	FormatNone LyricFormat = ""
+	// FormatPlain brackets rhyming parts and appends their vowels.
+	FormatPlain LyricFormat = "plain"
+	// FormatMarkdown emphasizes rhyming parts and appends their vowels.
+	FormatMarkdown LyricFormat = "markdown"
+	// FormatHTML surrounds rhyming parts and their vowels by span tags.
+	FormatHTML LyricFormat = "html"
+)
+
+// lyricFormatter decorates parts of annotated lyric.
+type lyricFormatter struct {
+	text   func(string) string
+	rhyme  func(string) string
+	vowels func(string) string
+	sep    string
+}
+
+var lyricFormatters = map[LyricFormat]lyricFormatter{
+	FormatPlain: {
+		text:   func(s string) string { return s },
+		rhyme:  func(s string) string { return "[" + s + "]" },
+		vowels: func(s string) string { return " (" + s + ")" },
+		sep:    "\n",
+	},
+	FormatMarkdown: {
+		text:   func(s string) string { return s },
+		rhyme:  func(s string) string { return "**" + s + "**" },
+		vowels: func(s string) string { return " `" + s + "`" },
+		sep:    "  \n",
+	},
+	FormatHTML: {
+		text:   html.EscapeString,
+		rhyme:  func(s string) string { return `<span class="rhyme">` + html.EscapeString(s) + "</span>" },
+		vowels: func(s string) string { return ` <span class="vowels">` + html.EscapeString(s) + "</span>" },
+		sep:    "<br>\n",
+	},
+}
+
+// Annotate renders lyric in format. Morphs which have rhyming morae are
+// marked, and vowels of the rhyming morae are appended to each line.
+// Rhyming morae are decided by RhymeMarks.
+func (rap *Rapper) Annotate(lyric Lyric, format LyricFormat) (string, error) {
+	if format == FormatNone {
+		return lyric.String(), nil
+	}
+	f, ok := lyricFormatters[format]
+	if !ok {
+		return "", fmt.Errorf("unknown lyric format %q", format)
+	}
+
+	marks := rap.RhymeMarks(lyric)
+	lines := make([]string, len(lyric))
+	for i, line := range lyric {
+		lines[i] = annotateLine(f, line, marks[i])
+	}
+	return strings.Join(lines, f.sep), nil
+}
+
+// annotateLine renders line with marks.
+func annotateLine(f lyricFormatter, line Sentence, marks []bool) string {
+	if marks == nil {
+		return f.text(line.String())
+	}
+
+	var b, run strings.Builder
+	var vowels []string
+	idx := 0
+	for _, morph := range line {
+		morae, _ := morph.Morae()
+		rhyme := false
+		for _, mora := range morae {
+			if marks[idx] {
+				rhyme = true
+				vowels = append(vowels, mora.Vowel())
+			}
+			idx++
+		}
+
+		if rhyme {
+			run.WriteString(morph.Surface)
+			continue
+		}
+		if run.Len() > 0 {
+			b.WriteString(f.rhyme(run.String()))
+			run.Reset()
+		}
+		b.WriteString(f.text(morph.Surface))
+	}
+	if run.Len() > 0 {
+		b.WriteString(f.rhyme(run.String()))
+	}
+	if len(vowels) > 0 {
+		b.WriteString(f.vowels(strings.Join(vowels, "-")))
+	}
+	return b.String()
+}
+
+// Render renders lyric in the rapper's format.
+func (rap *Rapper) Render(lyric Lyric) string {
+	text, err := rap.Annotate(lyric, rap.format)
+	if err != nil {
+		return lyric.String()
+	}
+	return text
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRapper_Annotate(t *testing.T) {
+	rapper := Rapper{weights: []Weight{{1.0, 1.0}, {1.0, 1.0}}}
+	lyric := Lyric{
+		Sentence{
+			&Morph{"大胆", "", "", "", "", "", "", "", "", "ダイタン"},
+			&Morph{"に", "", "", "", "", "", "", "", "", "ニ"},
+			&Morph{"乾杯", "", "", "", "", "", "", "", "", "カンパイ"},
+		},
+		Sentence{
+			&Morph{"<b>", "", "", "", "", "", "", "", "", ""},
+		},
+		Sentence{
+			&Morph{"ラン", "", "", "", "", "", "", "", "", "ラン"},
+			&Morph{"タイ", "", "", "", "", "", "", "", "", "タイ"},
+		},
+		Sentence{
+			&Morph{"満タン", "", "", "", "", "", "", "", "", "マンタン"},
+		},
+	}
+
+	tests := []struct {
+		format LyricFormat
+		text   string
+	}{
+		{
+			FormatNone,
+			"大胆に乾杯\n<b>\nランタイ\n満タン",
+		},
+		{
+			FormatPlain,
+			"大胆に乾杯\n<b>\nラン[タイ] (a)\n[満タン] (a)",
+		},
+		{
+			FormatMarkdown,
+			"大胆に乾杯  \n<b>  \nラン**タイ** `a`  \n**満タン** `a`",
+		},
+		{
+			FormatHTML,
+			"大胆に乾杯<br>\n&lt;b&gt;<br>\n" +
+				`ラン<span class="rhyme">タイ</span> <span class="vowels">a</span><br>` + "\n" +
+				`<span class="rhyme">満タン</span> <span class="vowels">a</span>`,
+		},
+	}
+
+	for idx, test := range tests {
+		text, err := rapper.Annotate(lyric, test.format)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+		}
+		if text != test.text {
+			t.Errorf("[%d] expected\n%v\nbut got\n%v", idx, test.text, text)
+		}
+	}
+
+	if _, err := rapper.Annotate(lyric, "unknown"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestRunAnnotate(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := runAnnotate([]string{"-format", "markdown"}, strings.NewReader("まじか\nあした\n"), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "**まじか** `a-i-a`  \n**あした** `a-i-a`\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// morphID is an interned Morph.
+type morphID uint32
+
+// IDs of BOS and EOS. They are interned by every vocabulary.
+const (
+	bosID morphID = iota
+	eosID
+)
+
+// vocabulary interns morphs into IDs. It is shared by the chains of a
+// Markov, so each distinct morph is stored only once. It is safe for
+// concurrent use, and readers never wait for intern. Morphs are never
+// removed, so Markov replaces the vocabulary with a compacted one when
+// chains forget many morphs.
+type vocabulary struct {
+	mu     *sync.Mutex   // serializes intern
+	ids    *sync.Map     // Morph to morphID
+	morphs *atomic.Value // []*Morph indexed by ID. Elements are never modified.
+}
+
+// newVocabulary returns new vocabulary which has BOS and EOS.
+func newVocabulary() *vocabulary {
+	v := &vocabulary{
+		mu:     new(sync.Mutex),
+		ids:    new(sync.Map),
+		morphs: new(atomic.Value),
+	}
+	v.morphs.Store([]*Morph(nil))
+	v.intern(&BOS)
+	v.intern(&EOS)
+	return v
+}
+
+// intern returns the ID of m. A new ID is given if m is unknown.
+func (v *vocabulary) intern(m *Morph) morphID {
+	if id, ok := v.id(m); ok {
+		return id
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if id, ok := v.id(m); ok {
+		return id
+	}
+	copied := *m
+	morphs := v.morphs.Load().([]*Morph)
+	id := morphID(len(morphs))
+	// Readers see only their own length of morphs, so appending in place
+	// does not race with them.
+	v.morphs.Store(append(morphs, &copied))
+	v.ids.Store(copied, id)
+	return id
+}
+
+// internAll interns morphs into ids.
+func (v *vocabulary) internAll(morphs []*Morph) []morphID {
+	ids := make([]morphID, len(morphs))
+	for i, m := range morphs {
+		ids[i] = v.intern(m)
+	}
+	return ids
+}
+
+// id returns the ID of m if m is known.
+func (v *vocabulary) id(m *Morph) (morphID, bool) {
+	id, ok := v.ids.Load(*m)
+	if !ok {
+		return 0, false
+	}
+	return id.(morphID), true
+}
+
+// idsOf returns the IDs of morphs. ok is false if any morph is unknown.
+func (v *vocabulary) idsOf(morphs []*Morph) (ids []morphID, ok bool) {
+	ids = make([]morphID, len(morphs))
+	for i, m := range morphs {
+		if ids[i], ok = v.id(m); !ok {
+			return nil, false
+		}
+	}
+	return ids, true
+}
+
+// compact returns new vocabulary which has only BOS, EOS and morphs whose
+// IDs are live, and the new IDs of old IDs. New IDs keep the order of old
+// IDs.
+func (v *vocabulary) compact(live []bool) (*vocabulary, []morphID) {
+	morphs := v.morphs.Load().([]*Morph)
+	compacted := &vocabulary{
+		mu:     new(sync.Mutex),
+		ids:    new(sync.Map),
+		morphs: new(atomic.Value),
+	}
+	var kept []*Morph
+	newIDs := make([]morphID, len(morphs))
+	for id, m := range morphs {
+		if morphID(id) > eosID && !live[id] {
+			continue
+		}
+		newIDs[id] = morphID(len(kept))
+		compacted.ids.Store(*m, newIDs[id])
+		kept = append(kept, m)
+	}
+	compacted.morphs.Store(kept)
+	return compacted, newIDs
+}
+
+// morph returns the Morph of id. The Morph is shared and must not be
+// modified.
+func (v *vocabulary) morph(id morphID) *Morph {
+	return v.morphs.Load().([]*Morph)[id]
+}
+
+// Len returns the number of morphs.
+func (v *vocabulary) Len() int {
+	return len(v.morphs.Load().([]*Morph))
+}
+
+// chain is a markov chain trie of morph IDs. Nodes are kept in a slice and
+// refer to their children by index, so a chain has no maps and few
+// pointers.
+type chain struct {
+	nodes []chainNode // nodes[0] is the root.
+
+	// backoff[j-1] has ngrams of j morphs which are suffixes of longer
+	// ngrams. Their weights are continuation counts of Kneser-Ney, the
+	// numbers of distinct morphs which precede them.
+	backoff []*chain
+}
+
+// chainNode is a node of chain.
+type chainNode struct {
+	edges []chainEdge // sorted by id
+}
+
+// chainEdge is an edge to the next morph.
+type chainEdge struct {
+	id     morphID
+	weight float32 // sum of weights of added ngrams which pass the edge
+	next   int32   // index of the child node. -1 means no child.
+}
+
+// newChain returns new empty chain.
+func newChain() *chain {
+	return &chain{nodes: make([]chainNode, 1)}
+}
+
+// Len returns the number of morphs which begin ngrams.
+func (c *chain) Len() int {
+	return len(c.nodes[0].edges)
+}
+
+// find returns the index of the edge of id in node, or the index where
+// it should be inserted.
+func (c *chain) find(node int32, id morphID) (idx int, ok bool) {
+	edges := c.nodes[node].edges
+	idx = sort.Search(len(edges), func(i int) bool { return edges[i].id >= id })
+	return idx, idx < len(edges) && edges[idx].id == id
+}
+
+// Add adds ids with weight.
+func (c *chain) Add(ids []morphID, weight float32) {
+	var node int32
+	for i, id := range ids {
+		idx, ok := c.find(node, id)
+		if !ok {
+			edges := append(c.nodes[node].edges, chainEdge{})
+			copy(edges[idx+1:], edges[idx:])
+			edges[idx] = chainEdge{id: id, next: -1}
+			c.nodes[node].edges = edges
+		}
+
+		edge := &c.nodes[node].edges[idx]
+		edge.weight += weight
+		if i == len(ids)-1 {
+			return
+		}
+		if edge.next < 0 {
+			edge.next = int32(len(c.nodes))
+			c.nodes = append(c.nodes, chainNode{})
+		}
+		node = edge.next
+	}
+}
+
+// RandomID returns a random ID which follows ids. IDs are chosen in
+// proportion to their weights.
+func (c *chain) RandomID(ids []morphID) (id morphID, ok bool) {
+	id, _, ok = c.randomDiscountedID(ids, 0)
+	return
+}
+
+// randomUniformID returns a random ID which follows ids. IDs are chosen
+// uniformly regardless of their weights.
+func (c *chain) randomUniformID(ids []morphID) (id morphID, ok bool) {
+	edges := c.edges(ids)
+	if len(edges) == 0 {
+		return 0, false
+	}
+	return edges[rand.Intn(len(edges))].id, true
+}
+
+// randomDiscountedID returns a random ID which follows ids after discount is
+// subtracted from each weight. If no ID follows ids, ok is false. If the
+// discounted weight is chosen, backoff is true and ok is false.
+func (c *chain) randomDiscountedID(ids []morphID, discount float64) (id morphID, backoff, ok bool) {
+	edges := c.edges(ids)
+	if len(edges) == 0 {
+		return 0, false, false
+	}
+
+	var sum float64
+	for _, edge := range edges {
+		sum += float64(edge.weight)
+	}
+	r := rand.Float64() * sum
+	for _, edge := range edges {
+		w := math.Max(float64(edge.weight)-discount, 0)
+		if r < w {
+			return edge.id, false, true
+		}
+		r -= w
+	}
+	if discount > 0 {
+		return 0, true, false
+	}
+	return edges[len(edges)-1].id, false, true
+}
+
+// edges returns edges to morphs which follow ids.
+func (c *chain) edges(ids []morphID) []chainEdge {
+	var node int32
+	for _, id := range ids {
+		idx, ok := c.find(node, id)
+		if !ok {
+			return nil
+		}
+		node = c.nodes[node].edges[idx].next
+		if node < 0 {
+			return nil
+		}
+	}
+	return c.nodes[node].edges
+}
+
+// paths calls f with every path from the root to a leaf. ids must not be
+// retained.
+func (c *chain) paths(f func(ids []morphID)) {
+	var walk func(node int32, ids []morphID)
+	walk = func(node int32, ids []morphID) {
+		for _, edge := range c.nodes[node].edges {
+			path := append(ids, edge.id)
+			if edge.next < 0 {
+				f(path)
+			} else {
+				walk(edge.next, path)
+			}
+		}
+	}
+	walk(0, nil)
+}
+
+// BuildBackoff builds c.backoff from ngrams of n morphs.
+func (c *chain) BuildBackoff(n int) {
+	c.backoff = make([]*chain, n-1)
+	higher := c
+	for j := n - 1; j >= 1; j-- {
+		lower := newChain()
+		higher.paths(func(ids []morphID) {
+			if len(ids) > 1 {
+				lower.Add(ids[1:], 1)
+			}
+		})
+		c.backoff[j-1] = lower
+		higher = lower
+	}
+}
+
+// Decay returns new chain whose weights are multiplied by factor. Edges
+// whose weights become less than min are pruned.
+func (c *chain) Decay(factor, min float32) *chain {
+	decayed := newChain()
+	var decay func(src, dst int32)
+	decay = func(src, dst int32) {
+		for _, edge := range c.nodes[src].edges {
+			edge.weight *= factor
+			if edge.weight < min {
+				continue
+			}
+			if edge.next >= 0 {
+				next := int32(len(decayed.nodes))
+				decayed.nodes = append(decayed.nodes, chainNode{})
+				decay(edge.next, next)
+				if len(decayed.nodes[next].edges) == 0 {
+					// all children are pruned
+					decayed.nodes = decayed.nodes[:next]
+					continue
+				}
+				edge.next = next
+			}
+			decayed.nodes[dst].edges = append(decayed.nodes[dst].edges, edge)
+		}
+	}
+	decay(0, 0)
+	return decayed
+}
+
+// markIDs sets live[id] to true for every ID in c.
+func (c *chain) markIDs(live []bool) {
+	for _, node := range c.nodes {
+		for _, edge := range node.edges {
+			live[edge.id] = true
+		}
+	}
+}
+
+// Remap returns a copy of c and its back-off whose IDs are replaced by
+// newIDs. newIDs must keep the order of IDs, so that edges stay sorted.
+func (c *chain) Remap(newIDs []morphID) *chain {
+	remapped := &chain{nodes: make([]chainNode, len(c.nodes))}
+	for i, node := range c.nodes {
+		edges := make([]chainEdge, len(node.edges))
+		for j, edge := range node.edges {
+			edge.id = newIDs[edge.id]
+			edges[j] = edge
+		}
+		remapped.nodes[i].edges = edges
+	}
+	for _, b := range c.backoff {
+		remapped.backoff = append(remapped.backoff, b.Remap(newIDs))
+	}
+	return remapped
+}
+
+// Clone returns a copy of c.
+func (c *chain) Clone() *chain {
+	clone := &chain{nodes: make([]chainNode, len(c.nodes))}
+	for i, node := range c.nodes {
+		clone.nodes[i].edges = append([]chainEdge(nil), node.edges...)
+	}
+	return clone
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// commands are subcommands of rapbot. They read a lyric from r and write the
+// result to w. .env is read by main beforehand if it exists.
+var commands = map[string]func(args []string, r io.Reader, w io.Writer) error{
+	"timeline": runTimeline,
+	"annotate": runAnnotate,
+}
+
+// cliRapper returns a rapper for commands. Weights in .env are used if set.
+func cliRapper() (*Rapper, error) {
+	if os.Getenv("CONSONANT_WEIGHTS") == "" && os.Getenv("VOWEL_WEIGHTS") == "" {
+		return &Rapper{weights: []Weight{{1, 1}, {1, 1}, {1, 1}, {1, 1}}}, nil
+	}
+	weights, err := parseWeights()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rapper: weights: %w", err)
+	}
+	return &Rapper{weights: weights}, nil
+}
+
+// readLyric reads lines of a lyric from r. Empty lines are ignored.
+// The user dictionary in .env is used if set.
+func readLyric(r io.Reader) (Lyric, error) {
+	analyzer, err := DefaultAnalyzer()
+	if err != nil {
+		return nil, err
+	}
+	defer analyzer.Close()
+
+	var lyric Lyric
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		lyric = append(lyric, trimBOSEOS(analyzer.Analyze(text)))
+	}
+	return lyric, scanner.Err()
+}
+
+// runTimeline is "timeline" command. It writes the timeline of the lyric.
+func runTimeline(args []string, r io.Reader, w io.Writer) error {
+	flags := flag.NewFlagSet("timeline", flag.ContinueOnError)
+	bpm := flags.Float64("bpm", 90, "beats per minute")
+	beats := flags.Int("beats", 4, "beats per line")
+	format := flags.String("format", "lrc", "output format (lrc or json)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	lyric, err := readLyric(r)
+	if err != nil {
+		return err
+	}
+	rap, err := cliRapper()
+	if err != nil {
+		return err
+	}
+	timeline, err := rap.NewTimeline(lyric, *bpm, *beats)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "lrc":
+		_, err = io.WriteString(w, timeline.LRC())
+	case "json":
+		var b []byte
+		b, err = timeline.JSON()
+		if err == nil {
+			_, err = w.Write(append(b, '\n'))
+		}
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	return err
+}
+
+// runAnnotate is "annotate" command. It writes the lyric with rhyme marks.
+func runAnnotate(args []string, r io.Reader, w io.Writer) error {
+	flags := flag.NewFlagSet("annotate", flag.ContinueOnError)
+	format := flags.String("format", "plain", "output format (plain, markdown or html)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	lyric, err := readLyric(r)
+	if err != nil {
+		return err
+	}
+	rap, err := cliRapper()
+	if err != nil {
+		return err
+	}
+	text, err := rap.Annotate(lyric, LyricFormat(*format))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, text+"\n")
+	return err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// CopyGuard remembers recently learned sentences and detects generated
+// sentences which copy them. A generated sentence is a copy if it contains
+// more than maxCopy consecutive morphs of a single learned sentence, or if
+// it is a whole learned sentence.
+type CopyGuard struct {
+	window       int // maxCopy + 1
+	maxSentences int // number of remembered sentences
+	mu           *sync.RWMutex
+	counts       map[uint64]int // number of remembered sentences which have the hash
+	history      [][]uint64     // ring buffer of hashes of each sentence
+	next         int
+}
+
+// NewCopyGuard returns new CopyGuard which remembers maxSentences sentences.
+func NewCopyGuard(maxCopy, maxSentences int) *CopyGuard {
+	if maxSentences < 1 {
+		maxSentences = 1
+	}
+	return &CopyGuard{
+		window:       maxCopy + 1,
+		maxSentences: maxSentences,
+		mu:           new(sync.RWMutex),
+		counts:       map[uint64]int{},
+		history:      make([][]uint64, 0, maxSentences),
+	}
+}
+
+// Add remembers sentence. The oldest sentence will be forgotten if
+// there are too many sentences.
+func (cg *CopyGuard) Add(sentence Sentence) {
+	hashes := cg.hashes(trimBOSEOS(sentence))
+	if len(hashes) == 0 {
+		return
+	}
+
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+
+	if len(cg.history) < cg.maxSentences {
+		cg.history = append(cg.history, hashes)
+	} else {
+		for _, h := range cg.history[cg.next] {
+			if cg.counts[h]--; cg.counts[h] <= 0 {
+				delete(cg.counts, h)
+			}
+		}
+		cg.history[cg.next] = hashes
+		cg.next = (cg.next + 1) % cg.maxSentences
+	}
+	for _, h := range hashes {
+		cg.counts[h]++
+	}
+}
+
+// IsCopied returns whether sentence copies a remembered sentence.
+func (cg *CopyGuard) IsCopied(sentence Sentence) bool {
+	hashes := cg.hashes(trimBOSEOS(sentence))
+
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+
+	for _, h := range hashes {
+		if cg.counts[h] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hashes returns the hash of whole sentence and the hashes of windows.
+// Each hash of a sentence appears only once.
+func (cg *CopyGuard) hashes(sentence Sentence) []uint64 {
+	if len(sentence) == 0 {
+		return nil
+	}
+
+	seen := map[uint64]bool{}
+	hashes := []uint64{}
+	add := func(h uint64) {
+		if !seen[h] {
+			seen[h] = true
+			hashes = append(hashes, h)
+		}
+	}
+
+	add(hashMorphs(sentence, true))
+	for i := 0; i+cg.window <= len(sentence); i++ {
+		add(hashMorphs(sentence[i:i+cg.window], false))
+	}
+	return hashes
+}
+
+// hashMorphs returns the hash of surfaces of morphs. whole distinguishes
+// whole sentences from windows.
+func hashMorphs(morphs Sentence, whole bool) uint64 {
+	h := fnv.New64a()
+	if whole {
+		h.Write([]byte{1})
+	}
+	for _, morph := range morphs {
+		h.Write([]byte(morph.Surface))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// trimBOSEOS removes BOS and EOS from sentence.
+func trimBOSEOS(sentence Sentence) Sentence {
+	if len(sentence) > 0 && *sentence[0] == BOS {
+		sentence = sentence[1:]
+	}
+	if len(sentence) > 0 && *sentence[len(sentence)-1] == EOS {
+		sentence = sentence[:len(sentence)-1]
+	}
+	return sentence
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+)
+
+func surfaces(strs ...string) Sentence {
+	sentence := Sentence{}
+	for _, str := range strs {
+		sentence = append(sentence, &Morph{Surface: str})
+	}
+	return sentence
+}
+
+func TestCopyGuard_IsCopied(t *testing.T) {
+	learned := []Sentence{
+		append(append(Sentence{&BOS}, surfaces("今日", "は", "いい", "天気", "です", "ね")...), &EOS),
+		append(append(Sentence{&BOS}, surfaces("おはよう")...), &EOS),
+	}
+
+	tests := []struct {
+		sentence Sentence
+		copied   bool
+	}{
+		{surfaces("今日", "は", "いい", "天気"), true},
+		{surfaces("明日", "は", "いい", "天気"), false},
+		{surfaces("今日", "は", "いい"), false},
+		{surfaces("天気", "です", "ね", "今日"), false},
+		{surfaces("おはよう"), true},
+		{surfaces("おはよう", "です"), false},
+	}
+
+	cg := NewCopyGuard(3, 10)
+	for _, sentence := range learned {
+		cg.Add(sentence)
+	}
+	for idx, test := range tests {
+		if copied := cg.IsCopied(test.sentence); copied != test.copied {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.copied, copied)
+		}
+	}
+}
+
+func TestCopyGuard_Add(t *testing.T) {
+	cg := NewCopyGuard(1, 2)
+	cg.Add(surfaces("あ", "い"))
+	cg.Add(surfaces("う", "え"))
+	cg.Add(surfaces("お", "か"))
+
+	tests := []struct {
+		sentence Sentence
+		copied   bool
+	}{
+		{surfaces("あ", "い"), false}, // forgotten
+		{surfaces("う", "え"), true},
+		{surfaces("お", "か"), true},
+	}
+
+	for idx, test := range tests {
+		if copied := cg.IsCopied(test.sentence); copied != test.copied {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.copied, copied)
+		}
+	}
+	if len(cg.counts) != 4 { // whole sentence and a window for each
+		t.Errorf("expected 4 hashes, but got %v", len(cg.counts))
+	}
+}
+
+func TestMarkov_RandomSentence_copy(t *testing.T) {
+	m := newTestMarkov(
+		&MarkovParams{Ngram: 2},
+		[]mapChain{
+			mapChain{
+				BOS: mapChain{
+					Morph{Surface: "あ"}: mapChain{},
+				},
+				Morph{Surface: "あ"}: mapChain{
+					Morph{Surface: "い"}: mapChain{},
+				},
+				Morph{Surface: "い"}: mapChain{
+					EOS: mapChain{},
+				},
+			},
+		},
+	)
+	m.guard = NewCopyGuard(5, 10)
+
+	if _, ok := m.RandomSentence(5); !ok {
+		t.Errorf("expected ok before learning")
+	}
+	m.guard.Add(append(append(Sentence{&BOS}, surfaces("あ", "い")...), &EOS))
+	if sentence, ok := m.RandomSentence(5); ok {
+		t.Errorf("expected copy rejected, but got %v", sentence)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// englishWords are katakana pronunciations of common English words.
+var englishWords = map[string]string{
+	"a": "ア", "all": "オール", "and": "アンド", "baby": "ベイビー", "back": "バック",
+	"bad": "バッド", "beat": "ビート", "best": "ベスト", "big": "ビッグ", "black": "ブラック",
+	"blue": "ブルー", "body": "ボディー", "boss": "ボス", "bot": "ボット", "boy": "ボーイ",
+	"bro": "ブロ", "cake": "ケーキ", "check": "チェック", "chill": "チル", "city": "シティー", "club": "クラブ",
+	"come": "カム", "cool": "クール", "crazy": "クレイジー", "dance": "ダンス", "dj": "ディージェー",
+	"down": "ダウン", "dream": "ドリーム", "everybody": "エブリバディー", "everything": "エブリシング",
+	"fake": "フェイク", "fire": "ファイア", "flow": "フロー", "forever": "フォーエバー", "free": "フリー",
+	"funky": "ファンキー", "game": "ゲーム", "gang": "ギャング", "get": "ゲット", "girl": "ガール",
+	"go": "ゴー", "gold": "ゴールド", "good": "グッド", "groove": "グルーブ", "happy": "ハッピー",
+	"heart": "ハート", "hey": "ヘイ", "high": "ハイ", "hip": "ヒップ", "homie": "ホーミー",
+	"hop": "ホップ", "how": "ハウ", "hustle": "ハッスル", "i": "アイ", "in": "イン",
+	"is": "イズ", "it": "イット", "king": "キング", "let": "レット", "life": "ライフ",
+	"little": "リトル", "love": "ラブ", "make": "メイク", "man": "マン", "mc": "エムシー",
+	"me": "ミー", "mic": "マイク", "mind": "マインド", "money": "マネー", "moon": "ムーン",
+	"music": "ミュージック", "my": "マイ", "never": "ネバー", "new": "ニュー", "night": "ナイト",
+	"no": "ノー", "nothing": "ナッシング", "now": "ナウ", "of": "オブ", "oh": "オー",
+	"ok": "オーケー", "okay": "オーケー", "old": "オールド", "on": "オン", "one": "ワン",
+	"party": "パーティー", "peace": "ピース", "please": "プリーズ", "rain": "レイン", "rap": "ラップ",
+	"rapper": "ラッパー", "real": "リアル", "red": "レッド", "rhyme": "ライム", "sky": "スカイ",
+	"sorry": "ソーリー", "soul": "ソウル", "star": "スター", "stop": "ストップ", "street": "ストリート",
+	"style": "スタイル", "sun": "サン", "swag": "スワッグ", "take": "テイク", "thank": "サンク",
+	"thanks": "サンクス", "the": "ザ", "three": "スリー", "time": "タイム", "to": "トゥー",
+	"top": "トップ", "twitter": "ツイッター", "two": "ツー", "up": "アップ", "vibes": "バイブス",
+	"we": "ウィー", "what": "ワット", "white": "ホワイト", "who": "フー", "why": "ホワイ",
+	"win": "ウィン", "word": "ワード", "world": "ワールド", "yeah": "イェー", "yes": "イエス",
+	"yo": "ヨー", "you": "ユー",
+}
+
+// englishPronunciation reads Latin-script words in English. Words which are
+// not in englishWords are transliterated by rules. Acronyms (e.g. "NHK") are
+// left to asciiPronunciation.
+func englishPronunciation(m *Morph) (string, bool) {
+	if !isEnglishWord(m.Surface) {
+		return "", false
+	}
+	word := strings.Replace(normalizeText(m.Surface), "'", "", -1)
+	if p, ok := englishWords[word]; ok {
+		return p, true
+	}
+	if isAcronym(m.Surface) {
+		return "", false
+	}
+	return transliterateEnglish(word), true
+}
+
+// isEnglishWord returns whether word consists of Latin letters and
+// apostrophes.
+func isEnglishWord(word string) bool {
+	var letters int
+	for _, r := range normalizeText(word) {
+		switch {
+		case 'a' <= r && r <= 'z':
+			letters++
+		case r == '\'':
+		default:
+			return false
+		}
+	}
+	return letters > 0
+}
+
+// isAcronym returns whether word is short and written in capitals, or has
+// no vowels.
+func isAcronym(word string) bool {
+	if !strings.ContainsAny(normalizeText(word), "aeiouy") {
+		return true
+	}
+	return len([]rune(word)) <= 4 && isCapitalWord(word)
+}
+
+// isCapitalWord returns whether word has no lower case letters (e.g. "DJ").
+func isCapitalWord(word string) bool {
+	for _, r := range word {
+		if unicode.IsLower(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// englishVowel is a katakana vowel (index of englishRows) followed by suffix.
+type englishVowel struct {
+	vowel  int
+	suffix string
+}
+
+// englishVowels are pronunciations of vowel letters.
+var englishVowels = map[string]englishVowel{
+	"a": {0, ""}, "i": {1, ""}, "u": {0, ""}, "e": {3, ""}, "o": {4, ""}, "y": {1, ""},
+	"ee": {1, "ー"}, "ea": {1, "ー"}, "ie": {1, "ー"}, "ey": {3, "イ"}, "oo": {2, "ー"},
+	"ou": {0, "ウ"}, "ow": {4, "ー"}, "aw": {4, "ー"}, "au": {4, "ー"}, "ai": {3, "イ"},
+	"ay": {3, "イ"}, "oa": {4, "ー"}, "oi": {4, "イ"}, "oy": {4, "イ"}, "ue": {2, "ー"},
+	"ui": {2, "ー"}, "ei": {3, "イ"}, "ew": {2, "ー"}, "eu": {2, "ー"},
+}
+
+// englishLongVowels are pronunciations of vowel letters before silent "e"
+// (e.g. "make", "time").
+var englishLongVowels = map[string]englishVowel{
+	"a": {3, "イ"}, "i": {0, "イ"}, "u": {2, "ー"}, "e": {1, "ー"}, "o": {4, "ー"},
+}
+
+// englishRows are katakana of consonants followed by ア, イ, ウ, エ and オ.
+var englishRows = map[string][5]string{
+	"":   {"ア", "イ", "ウ", "エ", "オ"},
+	"b":  {"バ", "ビ", "ブ", "ベ", "ボ"},
+	"c":  {"カ", "シ", "ク", "セ", "コ"},
+	"ch": {"チャ", "チ", "チュ", "チェ", "チョ"},
+	"ck": {"カ", "キ", "ク", "ケ", "コ"},
+	"d":  {"ダ", "ディ", "ドゥ", "デ", "ド"},
+	"f":  {"ファ", "フィ", "フ", "フェ", "フォ"},
+	"g":  {"ガ", "ギ", "グ", "ゲ", "ゴ"},
+	"h":  {"ハ", "ヒ", "フ", "ヘ", "ホ"},
+	"j":  {"ジャ", "ジ", "ジュ", "ジェ", "ジョ"},
+	"k":  {"カ", "キ", "ク", "ケ", "コ"},
+	"l":  {"ラ", "リ", "ル", "レ", "ロ"},
+	"m":  {"マ", "ミ", "ム", "メ", "モ"},
+	"n":  {"ナ", "ニ", "ヌ", "ネ", "ノ"},
+	"p":  {"パ", "ピ", "プ", "ペ", "ポ"},
+	"ph": {"ファ", "フィ", "フ", "フェ", "フォ"},
+	"r":  {"ラ", "リ", "ル", "レ", "ロ"},
+	"s":  {"サ", "シ", "ス", "セ", "ソ"},
+	"sh": {"シャ", "シ", "シュ", "シェ", "ショ"},
+	"t":  {"タ", "ティ", "トゥ", "テ", "ト"},
+	"th": {"サ", "スィ", "ス", "セ", "ソ"},
+	"v":  {"バ", "ビ", "ブ", "ベ", "ボ"},
+	"w":  {"ワ", "ウィ", "ウ", "ウェ", "ウォ"},
+	"y":  {"ヤ", "イ", "ユ", "イェ", "ヨ"},
+	"z":  {"ザ", "ジ", "ズ", "ゼ", "ゾ"},
+}
+
+// englishCodas are katakana of consonants which are not followed by vowels.
+var englishCodas = map[string]string{
+	"b": "ブ", "c": "ク", "ch": "チ", "ck": "ク", "d": "ド", "f": "フ", "g": "グ",
+	"h": "", "j": "ジ", "k": "ク", "l": "ル", "m": "ム", "n": "ン", "p": "プ",
+	"ph": "フ", "r": "ル", "s": "ス", "sh": "シュ", "t": "ト", "th": "ス", "v": "ブ",
+	"w": "ウ", "y": "イ", "z": "ズ",
+}
+
+// englishGeminates are doubled consonants which are read with ッ
+// (e.g. "hippy" is ひっぴー but "hello" is へろ).
+var englishGeminates = map[string]bool{
+	"b": true, "c": true, "ck": true, "d": true, "f": true, "g": true, "k": true,
+	"p": true, "s": true, "t": true, "z": true,
+}
+
+// englishSyllabicGeminates are doubled consonants which are read with ッ
+// before syllabic "le" (e.g. "apple" is あっぷる but "battle" is ばとる).
+var englishSyllabicGeminates = map[string]bool{
+	"c": true, "ck": true, "f": true, "k": true, "p": true,
+}
+
+// englishStops are consonants which double after a short vowel at the end
+// of a word (e.g. "hip" is ひっぷ).
+var englishStops = map[string]bool{
+	"b": true, "ch": true, "ck": true, "d": true, "g": true, "k": true, "p": true, "sh": true, "t": true,
+}
+
+// englishUnit is a consonant or vowel group of an English word.
+type englishUnit struct {
+	letters string
+	vowel   bool
+	double  bool // doubled consonant such as "pp"
+	long    bool // vowel before silent "e"
+}
+
+// transliterateEnglish converts a lower case English word into katakana by
+// rules. The result is rough, and readable by NewMorae unless it is empty
+// (e.g. "h").
+func transliterateEnglish(word string) string {
+	units := splitEnglish(word)
+
+	var b strings.Builder
+	var consonant *englishUnit
+	var afterVowel, shortVowel bool
+	for i := 0; i < len(units); i++ {
+		unit := &units[i]
+		if !unit.vowel {
+			if consonant != nil {
+				if consonant.letters == "m" && (unit.letters == "b" || unit.letters == "p") {
+					b.WriteString("ン") // "number"
+				} else if consonant.double && unit.letters == "l" && i == len(units)-1 &&
+					!englishSyllabicGeminates[consonant.letters] {
+					b.WriteString(englishCodas[consonant.letters]) // "battle"
+				} else {
+					b.WriteString(englishCoda(consonant, afterVowel))
+				}
+				afterVowel = false
+			}
+			consonant = unit
+			continue
+		}
+
+		vowel, ok := englishVowels[unit.letters]
+		if unit.long {
+			vowel = englishLongVowels[unit.letters]
+		} else if unit.letters == "y" && i == len(units)-1 && consonant != nil {
+			vowel = englishVowel{1, "ー"} // "happy"
+		} else if unit.letters == "e" && i == len(units)-2 && units[i+1].letters == "r" {
+			vowel = englishVowel{0, ""} // "rapper"
+		} else if !ok {
+			vowel = englishVowels[unit.letters[:1]]
+			rest := englishUnit{letters: unit.letters[1:], vowel: true}
+			units = append(units[:i+1], append([]englishUnit{rest}, units[i+1:]...)...)
+		}
+
+		row := ""
+		if consonant != nil {
+			row = consonant.letters
+			if row == "c" && !strings.ContainsAny(unit.letters[:1], "eiy") {
+				row = "k"
+			}
+			if consonant.double && englishGeminates[row] {
+				b.WriteString("ッ")
+			}
+		}
+		b.WriteString(englishRows[row][vowel.vowel] + vowel.suffix)
+		consonant = nil
+		afterVowel = vowel.suffix != "ー"
+		shortVowel = len(unit.letters) == 1 && vowel.suffix == ""
+	}
+	if consonant != nil {
+		if afterVowel && shortVowel && englishStops[consonant.letters] && !consonant.double {
+			b.WriteString("ッ")
+		}
+		b.WriteString(englishCoda(consonant, afterVowel))
+	}
+	return b.String()
+}
+
+// englishCoda returns katakana of consonant which is not followed by a
+// vowel. "r" after a vowel lengthens it.
+func englishCoda(consonant *englishUnit, afterVowel bool) string {
+	if consonant.letters == "r" && afterVowel {
+		return "ー"
+	}
+	if consonant.double && afterVowel && englishGeminates[consonant.letters] {
+		return "ッ" + englishCodas[consonant.letters] // "apple"
+	}
+	return englishCodas[consonant.letters]
+}
+
+// splitEnglish splits word into consonant and vowel groups.
+func splitEnglish(word string) []englishUnit {
+	word = strings.NewReplacer("wh", "w", "qu", "kw", "x", "ks").Replace(word)
+	isVowel := func(i int) bool {
+		switch word[i] {
+		case 'a', 'e', 'i', 'o', 'u':
+			return true
+		case 'y':
+			// "y" is a vowel unless it begins a syllable.
+			return i > 0 && (i+1 == len(word) || !strings.ContainsRune("aeiou", rune(word[i+1])))
+		case 'w':
+			// "w" after a vowel makes a diphthong (e.g. "ow", "ew").
+			return i > 0 && strings.ContainsRune("aeo", rune(word[i-1])) &&
+				(i+1 == len(word) || !strings.ContainsRune("aeiou", rune(word[i+1])))
+		}
+		return false
+	}
+
+	// Long vowels such as "igh" in "night" and "a" in "make".
+	long := map[int]bool{}
+	for i := strings.Index(word, "igh"); i >= 0; i = strings.Index(word, "igh") {
+		word = word[:i+1] + word[i+3:]
+		long[i] = true
+	}
+	if n := len(word); n >= 3 && strings.HasSuffix(word, "le") && !isVowel(n-3) {
+		word = word[:n-1] // "battle"
+	} else if n >= 4 && word[n-1] == 'e' && !isVowel(n-2) && isVowel(n-3) && !isVowel(n-4) {
+		// Silent "e" softens "c" and "g" (e.g. "nice", "page").
+		word = word[:n-2] + strings.NewReplacer("c", "s", "g", "j").Replace(word[n-2:n-1])
+		long[n-3] = true
+	}
+
+	var units []englishUnit
+	for i := 0; i < len(word); {
+		j := i + 1
+		if isVowel(i) {
+			for j < len(word) && isVowel(j) {
+				j++
+			}
+			units = append(units, englishUnit{letters: word[i:j], vowel: true, long: long[i] && j == i+1})
+			i = j
+			continue
+		}
+
+		unit := englishUnit{letters: word[i:j]}
+		if j < len(word) {
+			if _, ok := englishRows[word[i:j+1]]; ok && word[i] != word[j] {
+				unit.letters = word[i : j+1] // "sh", "ch", "ck", ...
+				j++
+			} else if word[i] == word[j] {
+				unit.double = true // "pp", "tt", ...
+				j++
+			}
+		}
+		if _, ok := englishRows[unit.letters]; !ok {
+			unit.letters = "k"
+		}
+		units = append(units, unit)
+		i = j
+	}
+	return units
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEnglishPronunciation(t *testing.T) {
+	tests := []struct {
+		surface       string
+		pronunciation string
+		ok            bool
+	}{
+		{"yeah", "イェー", true},
+		{"Money", "マネー", true},
+		{"ＦＬＯＷ", "フロー", true},
+		{"rocket", "ロケット", true},
+		{"cake", "ケーキ", true},
+		{"nice", "ナイス", true},
+		{"night", "ナイト", true},
+		{"battle", "バトル", true},
+		{"bottle", "ボトル", true},
+		{"puzzle", "パズル", true},
+		{"apple", "アップル", true},
+		{"number", "ナンバー", true},
+		{"don't", "ドント", true},
+		{"NHK", "", false},
+		{"JPOP", "", false},
+		{"ぴえん", "", false},
+		{"2020", "", false},
+	}
+
+	for idx, test := range tests {
+		m := &Morph{Surface: test.surface}
+		pronunciation, ok := englishPronunciation(m)
+		if test.ok != ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+		if test.pronunciation != pronunciation {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.pronunciation, pronunciation)
+		}
+	}
+}
+
+func TestTransliterateEnglish_pronounceable(t *testing.T) {
+	words := []string{
+		"a", "e", "y", "w", "aaa", "eye", "www", "yyy", "strength", "rhythm",
+		"queue", "beautiful", "through", "knight", "xylophone", "schwa",
+		"bubble", "jazz", "ck", "ooze", "player", "mother", "lol",
+	}
+
+	for idx, word := range words {
+		if p := transliterateEnglish(word); !isPronunciation(p) {
+			t.Errorf("[%d] expected %q to be pronounceable, but got %q", idx, word, p)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
@@ -20,6 +22,15 @@ func LoadEnv() error {
 	return nil
 }
 
+// LoadOptionalEnv reads .env if it exists. Unlike LoadEnv, values are not
+// verified.
+func LoadOptionalEnv() error {
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot read .env: %w", err)
+	}
+	return nil
+}
+
 func verifyEnv(envs []string) error {
 	entryies := []string{
 		"CONSUMER_KEY",
@@ -52,3 +63,61 @@ findLoop:
 
 	return nil
 }
+
+// envIntDefault returns the integer value of env name. If name is not set,
+// def will be returned.
+func envIntDefault(name string, def int) (int, error) {
+	str, ok := os.LookupEnv(name)
+	if !ok || str == "" {
+		return def, nil
+	}
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v: %w", name, err)
+	}
+	return val, nil
+}
+
+// envListDefault returns comma separated values of env name. Empty elements
+// are removed. If name is not set, def will be returned.
+func envListDefault(name string, def []string) []string {
+	str, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	list := []string{}
+	for _, elem := range strings.Split(str, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+	return list
+}
+
+// envBoolDefault returns the boolean value of env name. If name is not set,
+// def will be returned.
+func envBoolDefault(name string, def bool) (bool, error) {
+	str, ok := os.LookupEnv(name)
+	if !ok || str == "" {
+		return def, nil
+	}
+	val, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, fmt.Errorf("invalid %v: %w", name, err)
+	}
+	return val, nil
+}
+
+// envFloatDefault returns the float value of env name. If name is not set,
+// def will be returned.
+func envFloatDefault(name string, def float64) (float64, error) {
+	str, ok := os.LookupEnv(name)
+	if !ok || str == "" {
+		return def, nil
+	}
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v: %w", name, err)
+	}
+	return val, nil
+}
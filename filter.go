@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// TweetRule is a rule of TweetFilter.
+//
+// Field is one of numeric fields ("retweet", "quote", "reply", "hashtags",
+// "media", "urls", "mentions", "followers", "friends", "account_age_days",
+// "text_length") or string fields ("lang", "source", "text").
+// A numeric field matches if it is in [Min, Max], or is positive if neither
+// Min nor Max is set. A string field matches if it is one of Values and
+// matches Pattern (empty Values or Pattern is ignored).
+// If Deny is true, the tweet is rejected when the rule matches. Otherwise the
+// tweet is rejected when the rule does not match.
+type TweetRule struct {
+	Name    string   `json:"name"`
+	Field   string   `json:"field"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Values  []string `json:"values,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+	Deny    bool     `json:"deny,omitempty"`
+	re      *regexp.Regexp
+}
+
+// numericTweetFields extract numeric values of a tweet.
+var numericTweetFields = map[string]func(*twitter.Tweet) float64{
+	"retweet":  func(t *twitter.Tweet) float64 { return boolToFloat(t.RetweetedStatus != nil) },
+	"quote":    func(t *twitter.Tweet) float64 { return boolToFloat(t.QuotedStatus != nil) },
+	"reply":    func(t *twitter.Tweet) float64 { return boolToFloat(t.InReplyToScreenName != "") },
+	"hashtags": func(t *twitter.Tweet) float64 { return float64(len(tweetEntities(t).Hashtags)) },
+	"media":    func(t *twitter.Tweet) float64 { return float64(len(tweetEntities(t).Media)) },
+	"urls":     func(t *twitter.Tweet) float64 { return float64(len(tweetEntities(t).Urls)) },
+	"mentions": func(t *twitter.Tweet) float64 { return float64(len(tweetEntities(t).UserMentions)) },
+	"followers": func(t *twitter.Tweet) float64 {
+		return float64(tweetUser(t).FollowersCount)
+	},
+	"friends": func(t *twitter.Tweet) float64 {
+		return float64(tweetUser(t).FriendsCount)
+	},
+	"account_age_days": func(t *twitter.Tweet) float64 {
+		created, err := time.Parse(time.RubyDate, tweetUser(t).CreatedAt)
+		if err != nil {
+			return 0
+		}
+		return time.Since(created).Hours() / 24
+	},
+	"text_length": func(t *twitter.Tweet) float64 {
+		return float64(len([]rune(html.UnescapeString(t.Text))))
+	},
+}
+
+// stringTweetFields extract string values of a tweet.
+var stringTweetFields = map[string]func(*twitter.Tweet) string{
+	"lang":   func(t *twitter.Tweet) string { return t.Lang },
+	"source": func(t *twitter.Tweet) string { return sourceName(t.Source) },
+	"text":   func(t *twitter.Tweet) string { return html.UnescapeString(t.Text) },
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// tweetEntities returns entities of tweet. It is non-nil.
+func tweetEntities(tweet *twitter.Tweet) *twitter.Entities {
+	if tweet.Entities == nil {
+		return &twitter.Entities{}
+	}
+	return tweet.Entities
+}
+
+// tweetUser returns user of tweet. It is non-nil.
+func tweetUser(tweet *twitter.Tweet) *twitter.User {
+	if tweet.User == nil {
+		return &twitter.User{}
+	}
+	return tweet.User
+}
+
+// compile validates the rule and prepares its regexp.
+func (r *TweetRule) compile() error {
+	_, numeric := numericTweetFields[r.Field]
+	_, str := stringTweetFields[r.Field]
+	if !numeric && !str {
+		return fmt.Errorf("unknown field %q", r.Field)
+	}
+	if r.Name == "" {
+		r.Name = r.Field
+	}
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %v: %w", r.Name, err)
+		}
+		r.re = re
+	}
+	return nil
+}
+
+// Match returns whether the tweet matches the rule.
+func (r *TweetRule) Match(tweet *twitter.Tweet) bool {
+	if f, ok := numericTweetFields[r.Field]; ok {
+		val := f(tweet)
+		if r.Min == nil && r.Max == nil {
+			return val > 0
+		}
+		return (r.Min == nil || *r.Min <= val) && (r.Max == nil || val <= *r.Max)
+	}
+
+	val := stringTweetFields[r.Field](tweet)
+	if len(r.Values) > 0 {
+		found := false
+		for _, v := range r.Values {
+			if v == val {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.re == nil || r.re.MatchString(val)
+}
+
+// Accept returns whether the tweet passes the rule.
+func (r *TweetRule) Accept(tweet *twitter.Tweet) bool {
+	return r.Match(tweet) != r.Deny
+}
+
+// DefaultTweetRules are used when no rule file is given.
+func DefaultTweetRules() []*TweetRule {
+	min := 11.0
+	return []*TweetRule{
+		{Field: "lang", Values: []string{"ja"}}, // Japanese lang tweet
+		{Field: "reply", Deny: true},            // not reply
+		{Field: "hashtags", Deny: true},         // no hashtags
+		{Field: "media", Deny: true},            // no media
+		{Field: "urls", Deny: true},             // no urls
+		{Field: "mentions", Deny: true},         // no mentions
+		{Field: "friends", Min: &min},           // has some friends
+		{Field: "followers", Min: &min},         // has some followers
+	}
+}
+
+// TweetFilter filters spam tweets by rules. The rules are evaluated in order.
+type TweetFilter struct {
+	rules    []*TweetRule
+	mu       *sync.Mutex
+	accepted int64
+	rejected map[string]int64 // rejection counts by rule name
+}
+
+// DefaultTweetFilter uses .env values. Rules are read from LEARN_FILTER_FILE
+// as a JSON array of TweetRule.
+func DefaultTweetFilter() (*TweetFilter, error) {
+	path := os.Getenv("LEARN_FILTER_FILE")
+	if path == "" {
+		return NewTweetFilter(DefaultTweetRules())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read learn filter: %w", err)
+	}
+	defer f.Close()
+
+	var rules []*TweetRule
+	if err := json.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("cannot read learn filter: %w", err)
+	}
+	return NewTweetFilter(rules)
+}
+
+// NewTweetFilter returns new TweetFilter.
+func NewTweetFilter(rules []*TweetRule) (*TweetFilter, error) {
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid learn filter: %w", err)
+		}
+	}
+	return &TweetFilter{
+		rules:    rules,
+		mu:       new(sync.Mutex),
+		rejected: map[string]int64{},
+	}, nil
+}
+
+// Accept returns whether the tweet is learnable, and counts the result.
+func (tf *TweetFilter) Accept(tweet *twitter.Tweet) bool {
+	for _, rule := range tf.rules {
+		if !rule.Accept(tweet) {
+			tf.mu.Lock()
+			tf.rejected[rule.Name]++
+			tf.mu.Unlock()
+			return false
+		}
+	}
+
+	tf.mu.Lock()
+	tf.accepted++
+	tf.mu.Unlock()
+	return true
+}
+
+// Stats returns the number of accepted tweets and rejected tweets by rule.
+func (tf *TweetFilter) Stats() (accepted int64, rejected map[string]int64) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	rejected = make(map[string]int64, len(tf.rejected))
+	for name, n := range tf.rejected {
+		rejected[name] = n
+	}
+	return tf.accepted, rejected
+}
+
+func (tf *TweetFilter) String() string {
+	accepted, rejected := tf.Stats()
+	names := make([]string, 0, len(rejected))
+	for name := range rejected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	strs := []string{fmt.Sprintf("accepted=%d", accepted)}
+	for _, name := range names {
+		strs = append(strs, fmt.Sprintf("%v=%d", name, rejected[name]))
+	}
+	return strings.Join(strs, " ")
+}
+
+// StatsServer logs the filter stats forever.
+func (tf *TweetFilter) StatsServer(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		log.Println("learn filter:", tf)
+	}
+}
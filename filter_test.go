@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+func TestTweetFilter_Accept(t *testing.T) {
+	learnable := func() *twitter.Tweet {
+		return &twitter.Tweet{
+			Lang:     "ja",
+			Text:     "おはようございます",
+			Entities: &twitter.Entities{},
+			User: &twitter.User{
+				FriendsCount:   100,
+				FollowersCount: 100,
+				CreatedAt:      time.Now().AddDate(-1, 0, 0).Format(time.RubyDate),
+			},
+		}
+	}
+
+	tests := []struct {
+		rules    []*TweetRule
+		tweet    func(*twitter.Tweet)
+		ok       bool
+		rejected string
+	}{
+		{
+			DefaultTweetRules(),
+			func(*twitter.Tweet) {},
+			true,
+			"",
+		},
+		{
+			DefaultTweetRules(),
+			func(tw *twitter.Tweet) { tw.Lang = "en" },
+			false,
+			"lang",
+		},
+		{
+			DefaultTweetRules(),
+			func(tw *twitter.Tweet) { tw.Entities.Hashtags = []twitter.HashtagEntity{{Text: "tag"}} },
+			false,
+			"hashtags",
+		},
+		{
+			DefaultTweetRules(),
+			func(tw *twitter.Tweet) { tw.User.FriendsCount = 10 },
+			false,
+			"friends",
+		},
+		{
+			DefaultTweetRules(),
+			func(tw *twitter.Tweet) { tw.RetweetedStatus = &twitter.Tweet{} },
+			true,
+			"",
+		},
+		{
+			[]*TweetRule{{Field: "retweet", Deny: true}},
+			func(tw *twitter.Tweet) { tw.RetweetedStatus = &twitter.Tweet{} },
+			false,
+			"retweet",
+		},
+		{
+			[]*TweetRule{{Name: "new account", Field: "account_age_days", Min: floatPtr(30)}},
+			func(tw *twitter.Tweet) { tw.User.CreatedAt = time.Now().Format(time.RubyDate) },
+			false,
+			"new account",
+		},
+		{
+			[]*TweetRule{{Field: "text_length", Min: floatPtr(5), Max: floatPtr(140)}},
+			func(tw *twitter.Tweet) { tw.Text = "あ" },
+			false,
+			"text_length",
+		},
+		{
+			[]*TweetRule{{Field: "text", Pattern: "拡散|フォロー", Deny: true}},
+			func(tw *twitter.Tweet) { tw.Text = "拡散希望" },
+			false,
+			"text",
+		},
+		{
+			[]*TweetRule{{Field: "source", Values: []string{"Twitter for iPhone"}}},
+			func(tw *twitter.Tweet) {
+				tw.Source = `<a href="http://twitter.com/download/iphone" rel="nofollow">Twitter for iPhone</a>`
+			},
+			true,
+			"",
+		},
+	}
+
+	for idx, test := range tests {
+		tf, err := NewTweetFilter(test.rules)
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		tweet := learnable()
+		test.tweet(tweet)
+
+		if ok := tf.Accept(tweet); ok != test.ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+		accepted, rejected := tf.Stats()
+		if test.ok && accepted != 1 {
+			t.Errorf("[%d] expected accepted 1, but got %v", idx, accepted)
+		}
+		if !test.ok && rejected[test.rejected] != 1 {
+			t.Errorf("[%d] expected rejected by %v, but got %v", idx, test.rejected, rejected)
+		}
+	}
+}
+
+func TestNewTweetFilter(t *testing.T) {
+	tests := []struct {
+		rules []*TweetRule
+		ok    bool
+	}{
+		{[]*TweetRule{{Field: "lang"}}, true},
+		{[]*TweetRule{{Field: "unknown"}}, false},
+		{[]*TweetRule{{Field: "text", Pattern: "("}}, false},
+	}
+
+	for idx, test := range tests {
+		if _, err := NewTweetFilter(test.rules); (err == nil) != test.ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, err)
+		}
+	}
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
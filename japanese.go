@@ -28,46 +28,110 @@ var (
 	EOS = Morph{"EOS", "", "", "", "", "", "", "", "", ""}
 )
 
-// NewMorph returns new Morph.
+// NewMorph returns new Morph from a token of the IPA dictionary. If the
+// dictionary cannot pronounce the token, its pronunciation is guessed by
+// guessPronunciation.
 func NewMorph(token *tokenizer.Token) *Morph {
+	return ipaLayout.NewMorph(token)
+}
+
+// featureLayout is indices of token features for fields of Morph.
+// Negative index means the dictionary does not have the field.
+type featureLayout struct {
+	PartOfSpeech         int
+	PartOfSpeechSection1 int
+	PartOfSpeechSection2 int
+	PartOfSpeechSection3 int
+	ConjugatedForm1      int
+	ConjugatedForm2      int
+	Inflection           int
+	Reading              int
+	Pronunciation        int
+}
+
+var (
+	// ipaLayout is the layout of the IPA dictionary.
+	ipaLayout = &featureLayout{0, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	// uniLayout is the layout of UniDic. It has no reading of the surface,
+	// so the pronunciation is used as the reading.
+	uniLayout = &featureLayout{
+		PartOfSpeech:         0,
+		PartOfSpeechSection1: 1,
+		PartOfSpeechSection2: 2,
+		PartOfSpeechSection3: 3,
+		ConjugatedForm1:      4,
+		ConjugatedForm2:      5,
+		Inflection:           10,
+		Reading:              9,
+		Pronunciation:        9,
+	}
+)
+
+// NewMorph returns new Morph from a token of the dictionary.
+func (l *featureLayout) NewMorph(token *tokenizer.Token) *Morph {
 	morph := Morph{}
 	morph.Surface = token.Surface
 
 	if token.Class == tokenizer.DUMMY {
 		return &morph
 	}
+	if token.Class == tokenizer.USER {
+		// Features of user words are part of speech, tokens and reading.
+		features := token.Features()
+		morph.PartOfSpeech = features[0]
+		morph.PartOfSpeechSection1 = "*"
+		morph.PartOfSpeechSection2 = "*"
+		morph.PartOfSpeechSection3 = "*"
+		morph.ConjugatedForm1 = "*"
+		morph.ConjugatedForm2 = "*"
+		morph.Inflection = token.Surface
+		morph.Reading = features[2]
+		return pronounceMorph(&morph)
+	}
 
-	for i, feature := range token.Features() {
-		switch i {
-		case 0:
-			morph.PartOfSpeech = feature
-		case 1:
-			morph.PartOfSpeechSection1 = feature
-		case 2:
-			morph.PartOfSpeechSection2 = feature
-		case 3:
-			morph.PartOfSpeechSection3 = feature
-		case 4:
-			morph.ConjugatedForm1 = feature
-		case 5:
-			morph.ConjugatedForm2 = feature
-		case 6:
-			morph.Inflection = feature
-		case 7:
-			morph.Reading = feature
-		case 8:
-			morph.Pronunciation = feature
+	features := token.Features()
+	feature := func(i int) string {
+		if i < 0 || len(features) <= i {
+			return ""
 		}
+		return features[i]
 	}
-	return &morph
+	morph.PartOfSpeech = feature(l.PartOfSpeech)
+	morph.PartOfSpeechSection1 = feature(l.PartOfSpeechSection1)
+	morph.PartOfSpeechSection2 = feature(l.PartOfSpeechSection2)
+	morph.PartOfSpeechSection3 = feature(l.PartOfSpeechSection3)
+	morph.ConjugatedForm1 = feature(l.ConjugatedForm1)
+	morph.ConjugatedForm2 = feature(l.ConjugatedForm2)
+	morph.Inflection = feature(l.Inflection)
+	morph.Reading = feature(l.Reading)
+	morph.Pronunciation = feature(l.Pronunciation)
+	return pronounceMorph(&morph)
+}
+
+// pronounceMorph sets the guessed pronunciation to morph.
+func pronounceMorph(morph *Morph) *Morph {
+	if p, ok := guessPronunciation(morph); ok {
+		morph.Pronunciation = p
+	}
+	return morph
 }
 
 // Morae returns morae. If has unreadable morph, ok will be false.
+// Spaces have no morae but are readable.
 func (m *Morph) Morae() (morae Morae, ok bool) {
+	if m.IsSilent() {
+		return nil, true
+	}
 	morae, ok = NewMorae(m.Pronunciation)
 	return
 }
 
+// IsSilent returns whether the morph consists of spaces.
+func (m *Morph) IsSilent() bool {
+	return m.Surface != "" && strings.TrimSpace(m.Surface) == ""
+}
+
 func (m *Morph) String() string {
 	return "[" + fmt.Sprintf("%#v", m.Surface) + " " +
 		strings.Join([]string{
@@ -117,7 +181,24 @@ var katakana = map[string]*Mora{
 	"ツァ": &Mora{"ts", "a"}, "ツィ": &Mora{"ts", "i"}, "ツェ": &Mora{"ts", "e"}, "ツォ": &Mora{"ts", "o"},
 	"チェ": &Mora{"ch", "e"}, "シェ": &Mora{"sh", "e"}, "ジェ": &Mora{"j", "e"},
 	"ティ": &Mora{"t", "i"}, "ディ": &Mora{"d", "i"},
-	"デュ": &Mora{"d", "u"}, "トゥ": &Mora{"t", "u"},
+	"トゥ": &Mora{"t", "u"}, "ドゥ": &Mora{"d", "u"},
+	"テュ": &Mora{"ty", "u"}, "デュ": &Mora{"d", "u"},
+	"ヂャ": &Mora{"j", "a"}, "ヂュ": &Mora{"j", "u"}, "ヂェ": &Mora{"j", "e"}, "ヂョ": &Mora{"j", "o"},
+	"シィ": &Mora{"sh", "i"}, "チィ": &Mora{"ch", "i"}, "フゥ": &Mora{"f", "u"},
+	"キェ": &Mora{"ky", "e"}, "ギェ": &Mora{"gy", "e"}, "ニェ": &Mora{"ny", "e"}, "ヒェ": &Mora{"hy", "e"},
+	"ミェ": &Mora{"my", "e"}, "リェ": &Mora{"ry", "e"}, "ビェ": &Mora{"by", "e"}, "ピェ": &Mora{"py", "e"},
+	"クァ": &Mora{"kw", "a"}, "クィ": &Mora{"kw", "i"}, "クェ": &Mora{"kw", "e"}, "クォ": &Mora{"kw", "o"},
+	"グァ": &Mora{"gw", "a"}, "グィ": &Mora{"gw", "i"}, "グェ": &Mora{"gw", "e"}, "グォ": &Mora{"gw", "o"},
+	"クヮ": &Mora{"kw", "a"}, "グヮ": &Mora{"gw", "a"},
+	"スィ": &Mora{"s", "i"}, "ズィ": &Mora{"z", "i"},
+	"イェ": &Mora{"y", "e"},
+	"フャ": &Mora{"fy", "a"}, "フョ": &Mora{"fy", "o"},
+	"ヴ": &Mora{"v", "u"}, "ヴャ": &Mora{"vy", "a"}, "ヴュ": &Mora{"vy", "u"}, "ヴョ": &Mora{"vy", "o"},
+	"ヷ": &Mora{"v", "a"}, "ヸ": &Mora{"v", "i"}, "ヹ": &Mora{"v", "e"}, "ヺ": &Mora{"v", "o"},
+	"ヰ": &Mora{"w", "i"}, "ヱ": &Mora{"w", "e"},
+	"ァ": &Mora{"", "a"}, "ィ": &Mora{"", "i"}, "ゥ": &Mora{"", "u"}, "ェ": &Mora{"", "e"}, "ォ": &Mora{"", "o"},
+	"ャ": &Mora{"y", "a"}, "ュ": &Mora{"y", "u"}, "ョ": &Mora{"y", "o"}, "ヮ": &Mora{"w", "a"},
+	"ヵ": &Mora{"k", "a"}, "ヶ": &Mora{"k", "e"},
 	"ッ": &Mora{"*xtu", "*xtu"},
 }
 
@@ -137,8 +218,19 @@ func NewMora(kana string) (mora *Mora, ok bool) {
 	return
 }
 
+// Vowel returns the vowel of the mora. "N" means ン and "Q" means ッ.
+func (m *Mora) Vowel() string {
+	switch m.vowel {
+	case "*n":
+		return "N"
+	case "*xtu":
+		return "Q"
+	}
+	return m.vowel
+}
+
 func (m *Mora) String() string {
-	return "[" + m.consonant + " " + m.vowel + "]"
+	return m.Katakana()
 }
 
 // Morae is a slice of Mora
@@ -147,23 +239,47 @@ type Morae []*Mora
 // NewMorae returns new morae from katakana pronunciation.
 // If cannot build morae completely, ok will be false.
 func NewMorae(pronunciation string) (morae Morae, ok bool) {
+	kana, ok := SplitMorae(pronunciation)
+	for _, k := range kana {
+		if k == "ー" {
+			// ー after ン or ッ lengthens itself.
+			prev := morae[len(morae)-1]
+			if strings.HasPrefix(prev.vowel, "*") {
+				lengthened := *prev
+				morae = append(morae, &lengthened)
+			} else {
+				morae = append(morae, &Mora{"", prev.vowel})
+			}
+			continue
+		}
+		mora, _ := NewMora(k)
+		morae = append(morae, mora)
+	}
+	return
+}
+
+// SplitMorae splits katakana pronunciation into kana of each mora.
+// Two kana which make a mora (e.g. "キャ") are preferred to single kana.
+// Small kana which cannot make a mora with the previous kana are read as
+// normal size kana, and ー is read as a mora except at the beginning.
+// If cannot split completely, ok will be false.
+func SplitMorae(pronunciation string) (kana []string, ok bool) {
 	runes := append([]rune(pronunciation), '*') // "*" is dummy rune
 
 	for i := 0; i < len(runes)-1; i++ {
-		if mora, ok2 := NewMora(string(runes[i : i+2])); ok2 {
+		if _, ok2 := katakana[string(runes[i:i+2])]; ok2 {
 			// 拗音
-			morae = append(morae, mora)
+			kana = append(kana, string(runes[i:i+2]))
 			i++
-		} else if mora, ok2 := NewMora(string(runes[i])); ok2 {
-			morae = append(morae, mora)
-		} else if len(morae) > 0 && runes[i] == 'ー' {
-			mora := &Mora{"", morae[len(morae)-1].vowel}
-			morae = append(morae, mora)
+		} else if _, ok2 := katakana[string(runes[i])]; ok2 {
+			kana = append(kana, string(runes[i]))
+		} else if len(kana) > 0 && runes[i] == 'ー' {
+			kana = append(kana, string(runes[i]))
 		} else {
 			return
 		}
 	}
-	ok = len(morae) > 0
+	ok = len(kana) > 0
 	return
 }
 
@@ -193,6 +309,22 @@ func (se Sentence) Morae() (morae Morae, ok bool) {
 	return
 }
 
+// MoraKana returns kana of each mora of the sentence.
+func (se Sentence) MoraKana() (kana []string, ok bool) {
+	for _, morph := range se {
+		if morph.IsSilent() {
+			continue
+		}
+		k, ok2 := SplitMorae(morph.Pronunciation)
+		if !ok2 {
+			return
+		}
+		kana = append(kana, k...)
+	}
+	ok = len(kana) > 0
+	return
+}
+
 // String joins all surfaces.
 func (se Sentence) String() string {
 	builder := new(strings.Builder)
@@ -213,22 +345,18 @@ func (l Lyric) String() string {
 	return strings.Join(strs, "\n")
 }
 
-// JapaneseParseServer parse chTweets text and send it to ChMorphs.
-func JapaneseParseServer(chSentence chan<- Sentence, chString <-chan string) {
-	t := tokenizer.New()
-
-	for text := range chString {
-		chSentence <- analyzeText(&t, text)
-	}
+// analyzeText analyzes text into Sentence with the IPA dictionary.
+func analyzeText(t *tokenizer.Tokenizer, text string) Sentence {
+	return analyzeTokens(t.Tokenize(text), ipaLayout)
 }
 
-// analyzeText analyzes text into Sentence.
-func analyzeText(t *tokenizer.Tokenizer, text string) Sentence {
-	tokens := t.Tokenize(text)
+// analyzeTokens converts tokens of the dictionary whose layout is l into
+// Sentence.
+func analyzeTokens(tokens []tokenizer.Token, l *featureLayout) Sentence {
 	sentence := make(Sentence, 0, len(tokens))
 	for _, token := range tokens {
-		morph := NewMorph(&token)
+		morph := l.NewMorph(&token)
 		sentence = append(sentence, morph)
 	}
-	return sentence
+	return joinNumerals(sentence)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/ikawaha/kagome/tokenizer"
@@ -28,6 +29,41 @@ func TestNewMorae(t *testing.T) {
 			Morae{&Mora{"g", "o"}, &Mora{"f", "a"}, &Mora{"", "a"}},
 			true,
 		},
+		{
+			"ァヴュギェクァスィ",
+			Morae{&Mora{"", "a"}, &Mora{"vy", "u"}, &Mora{"gy", "e"}, &Mora{"kw", "a"}, &Mora{"s", "i"}},
+			true,
+		},
+		{
+			"ヰヱヮ",
+			Morae{&Mora{"w", "i"}, &Mora{"w", "e"}, &Mora{"w", "a"}},
+			true,
+		},
+		{
+			"ドゥトゥテュデュ",
+			Morae{&Mora{"d", "u"}, &Mora{"t", "u"}, &Mora{"ty", "u"}, &Mora{"d", "u"}},
+			true,
+		},
+		{
+			"ヂャヂュヂョ",
+			Morae{&Mora{"j", "a"}, &Mora{"j", "u"}, &Mora{"j", "o"}},
+			true,
+		},
+		{
+			"シィチィフゥ",
+			Morae{&Mora{"sh", "i"}, &Mora{"ch", "i"}, &Mora{"f", "u"}},
+			true,
+		},
+		{
+			"ンーッー",
+			Morae{&Mora{"*n", "*n"}, &Mora{"*n", "*n"}, &Mora{"*xtu", "*xtu"}, &Mora{"*xtu", "*xtu"}},
+			true,
+		},
+		{
+			"ーア",
+			nil,
+			false,
+		},
 		{
 			"　",
 			nil,
@@ -49,6 +85,63 @@ func TestNewMorae(t *testing.T) {
 			t.Errorf("[%d] expected %v, but got %v", idx, test.morae, morae)
 		}
 	}
+
+	// lengthened ン must not share the mora with the previous one
+	morae, _ := NewMorae("ンー")
+	if morae[0] == morae[1] {
+		t.Errorf("expected distinct morae, but got the same pointer")
+	}
+}
+
+func TestNewMorae_katakana(t *testing.T) {
+	// Every kana in the table parses alone and with ー.
+	for kana, mora := range katakana {
+		morae, ok := NewMorae(kana)
+		if !ok || len(morae) != 1 || *morae[0] != *mora {
+			t.Errorf("%v: expected [%v], but got %v", kana, mora, morae)
+		}
+		if morae, ok := NewMorae(kana + "ー"); !ok || len(morae) != 2 {
+			t.Errorf("%v: expected 2 morae, but got %v", kana+"ー", morae)
+		}
+	}
+}
+
+func FuzzNewMorae(f *testing.F) {
+	f.Add("", []byte{})
+	f.Add("ーア", []byte{0, 1, 0, 2})
+	f.Add("キャー", []byte{255, 128, 0, 3})
+	f.Add("abcあ", []byte{1, 7, 0, 7, 7})
+
+	kana := make([]string, 0, len(katakana))
+	for k := range katakana {
+		kana = append(kana, k)
+	}
+	sort.Strings(kana)
+
+	f.Fuzz(func(t *testing.T, pronunciation string, indices []byte) {
+		// Arbitrary input never panics.
+		if morae, ok := NewMorae(pronunciation); ok && len(morae) == 0 {
+			t.Errorf("expected some morae of %q, but got none", pronunciation)
+		}
+
+		// Any sequence of kana in the table parses, and so does ー after
+		// them. Each 2 bytes of indices choose a kana, and the lowest bit
+		// adds ー.
+		var valid string
+		for i := 0; i+1 < len(indices); i += 2 {
+			n := int(indices[i])<<8 | int(indices[i+1])
+			valid += kana[n/2%len(kana)]
+			if n%2 == 1 {
+				valid += "ー"
+			}
+		}
+		if valid == "" {
+			return
+		}
+		if morae, ok := NewMorae(valid); !ok || len(morae) == 0 {
+			t.Errorf("expected %q to be parsed, but got %v", valid, morae)
+		}
+	})
 }
 
 func TestAnalyzeText(t *testing.T) {
@@ -65,6 +158,15 @@ func TestAnalyzeText(t *testing.T) {
 				&Morph{"EOS", "", "", "", "", "", "", "", "", ""},
 			},
 		},
+		{
+			"ぴえんDJ",
+			Sentence{
+				&Morph{"BOS", "", "", "", "", "", "", "", "", ""},
+				&Morph{"ぴえん", "名詞", "一般", "*", "*", "*", "*", "*", "", "ピエン"},
+				&Morph{"DJ", "名詞", "固有名詞", "組織", "*", "*", "*", "*", "", "ディージェー"},
+				&Morph{"EOS", "", "", "", "", "", "", "", "", ""},
+			},
+		},
 	}
 
 	tk := tokenizer.New()
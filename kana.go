@@ -0,0 +1,169 @@
+package main
+
+import (
+	"strings"
+)
+
+// katakanaAliases are kana in katakana table which have the same mora as
+// other kana. They are not used to render morae.
+var katakanaAliases = map[string]bool{
+	"ヂ":  true, // ジ
+	"ヅ":  true, // ズ
+	"ヲ":  true, // オ
+	"ヰ":  true, // ウィ
+	"ヱ":  true, // ウェ
+	"ヷ":  true, // ヴァ
+	"ヸ":  true, // ヴィ
+	"ヹ":  true, // ヴェ
+	"ヺ":  true, // ヴォ
+	"ァ":  true, // ア
+	"ィ":  true, // イ
+	"ゥ":  true, // ウ
+	"ェ":  true, // エ
+	"ォ":  true, // オ
+	"ャ":  true, // ヤ
+	"ュ":  true, // ユ
+	"ョ":  true, // ヨ
+	"ヮ":  true, // ワ
+	"ヵ":  true, // カ
+	"ヶ":  true, // ケ
+	"クヮ": true, // クァ
+	"グヮ": true, // グァ
+	"デュ": true, // ドゥ
+	"ヂャ": true, // ジャ
+	"ヂュ": true, // ジュ
+	"ヂェ": true, // ジェ
+	"ヂョ": true, // ジョ
+	"シィ": true, // シ
+	"チィ": true, // チ
+	"フゥ": true, // フ
+}
+
+// moraKatakana is the reverse table of katakana.
+var moraKatakana = func() map[Mora]string {
+	table := make(map[Mora]string, len(katakana))
+	for kana, mora := range katakana {
+		if !katakanaAliases[kana] {
+			table[*mora] = kana
+		}
+	}
+	return table
+}()
+
+// Katakana returns katakana of the mora. Long vowels are rendered as vowels.
+func (m *Mora) Katakana() string {
+	return moraKatakana[*m]
+}
+
+// Katakana returns katakana of the morae.
+func (mo Morae) Katakana() string {
+	var b strings.Builder
+	for _, mora := range mo {
+		b.WriteString(mora.Katakana())
+	}
+	return b.String()
+}
+
+// Hiragana returns hiragana of the morae.
+func (mo Morae) Hiragana() string {
+	return toHiragana(mo.Katakana())
+}
+
+// Vowels returns vowel skeleton of the morae such as "a-i-u". ン and ッ are
+// "N" and "Q".
+func (mo Morae) Vowels() string {
+	vowels := make([]string, len(mo))
+	for i, mora := range mo {
+		vowels[i] = mora.Vowel()
+	}
+	return strings.Join(vowels, "-")
+}
+
+// Romaji returns Hepburn romanization of the morae without macrons.
+// ン before vowels and "y" is "n'", and ッ doubles the next consonant.
+func (mo Morae) Romaji() string {
+	var b strings.Builder
+	for i, mora := range mo {
+		var next *Mora
+		if i+1 < len(mo) {
+			next = mo[i+1]
+		}
+
+		switch mora.vowel {
+		case "*n":
+			b.WriteString("n")
+			if next != nil && (next.consonant == "" || strings.HasPrefix(next.consonant, "y")) &&
+				next.vowel != "*n" && next.vowel != "*xtu" {
+				b.WriteString("'")
+			}
+		case "*xtu":
+			switch {
+			case next == nil || next.consonant == "" || strings.HasPrefix(next.consonant, "*"):
+				b.WriteString("'")
+			case next.consonant == "ch":
+				b.WriteString("t")
+			default:
+				b.WriteString(next.consonant[:1])
+			}
+		default:
+			b.WriteString(mora.consonant + mora.vowel)
+		}
+	}
+	return b.String()
+}
+
+// Katakana returns katakana of the sentence's morae.
+func (se Sentence) Katakana() (string, bool) {
+	morae, ok := se.Morae()
+	if !ok {
+		return "", false
+	}
+	return morae.Katakana(), true
+}
+
+// Hiragana returns hiragana of the sentence's morae.
+func (se Sentence) Hiragana() (string, bool) {
+	morae, ok := se.Morae()
+	if !ok {
+		return "", false
+	}
+	return morae.Hiragana(), true
+}
+
+// Romaji returns Hepburn romanization of the sentence's morae.
+func (se Sentence) Romaji() (string, bool) {
+	morae, ok := se.Morae()
+	if !ok {
+		return "", false
+	}
+	return morae.Romaji(), true
+}
+
+// Vowels returns vowel skeleton of the sentence's morae.
+func (se Sentence) Vowels() (string, bool) {
+	morae, ok := se.Morae()
+	if !ok {
+		return "", false
+	}
+	return morae.Vowels(), true
+}
+
+// toHiragana converts katakana in str into hiragana.
+func toHiragana(str string) string {
+	return strings.Map(func(r rune) rune {
+		if 'ァ' <= r && r <= 'ヶ' {
+			return r - ('ァ' - 'ぁ')
+		}
+		return r
+	}, str)
+}
+
+// toKatakana converts hiragana in str into katakana.
+func toKatakana(str string) string {
+	return strings.Map(func(r rune) rune {
+		if 'ぁ' <= r && r <= 'ゖ' {
+			return r + ('ァ' - 'ぁ')
+		}
+		return r
+	}, str)
+}
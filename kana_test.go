@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func TestMorae_Katakana_roundTrip(t *testing.T) {
+	for kana, mora := range katakana {
+		morae, ok := NewMorae(kana)
+		if !ok {
+			t.Errorf("%v: cannot build morae", kana)
+			continue
+		}
+
+		expected := kana
+		if katakanaAliases[kana] {
+			expected = moraKatakana[*mora]
+		}
+		if got := morae.Katakana(); got != expected {
+			t.Errorf("%v: expected %v, but got %v", kana, expected, got)
+		}
+
+		again, ok := NewMorae(morae.Katakana())
+		if !ok || len(again) != 1 || *again[0] != *mora {
+			t.Errorf("%v: expected %v, but got %v", kana, mora, again)
+		}
+	}
+
+	if len(moraKatakana) != len(katakana)-len(katakanaAliases) {
+		t.Errorf("katakana table has ambiguous morae: %v != %v - %v",
+			len(moraKatakana), len(katakana), len(katakanaAliases))
+	}
+}
+
+func TestMorae_Conversion(t *testing.T) {
+	tests := []struct {
+		pronunciation string
+		katakana      string
+		hiragana      string
+		romaji        string
+		vowels        string
+	}{
+		{"オハヨー", "オハヨオ", "おはよお", "ohayoo", "o-a-o-o"},
+		{"シンブン", "シンブン", "しんぶん", "shinbun", "i-N-u-N"},
+		{"キンエン", "キンエン", "きんえん", "kin'en", "i-N-e-N"},
+		{"コンヤ", "コンヤ", "こんや", "kon'ya", "o-N-a"},
+		{"マッチャ", "マッチャ", "まっちゃ", "matcha", "a-Q-a"},
+		{"ザッシ", "ザッシ", "ざっし", "zasshi", "a-Q-i"},
+		{"アッ", "アッ", "あっ", "a'", "a-Q"},
+		{"ヂヅヲ", "ジズオ", "じずお", "jizuo", "i-u-o"},
+		{"ヴァイオリン", "ヴァイオリン", "ゔぁいおりん", "vaiorin", "a-i-o-i-N"},
+	}
+
+	for idx, test := range tests {
+		morae, ok := NewMorae(test.pronunciation)
+		if !ok {
+			t.Errorf("[%d] cannot build morae", idx)
+			continue
+		}
+		if got := morae.Katakana(); got != test.katakana {
+			t.Errorf("[%d] katakana: expected %v, but got %v", idx, test.katakana, got)
+		}
+		if got := morae.Hiragana(); got != test.hiragana {
+			t.Errorf("[%d] hiragana: expected %v, but got %v", idx, test.hiragana, got)
+		}
+		if got := morae.Romaji(); got != test.romaji {
+			t.Errorf("[%d] romaji: expected %v, but got %v", idx, test.romaji, got)
+		}
+		if got := morae.Vowels(); got != test.vowels {
+			t.Errorf("[%d] vowels: expected %v, but got %v", idx, test.vowels, got)
+		}
+	}
+}
+
+func TestSentence_Romaji(t *testing.T) {
+	tests := []struct {
+		sentence Sentence
+		romaji   string
+		ok       bool
+	}{
+		{
+			Sentence{
+				&Morph{"まじ", "名詞", "形容動詞語幹", "*", "*", "*", "*", "まじ", "マジ", "マジ"},
+				&Morph{"か", "助詞", "副助詞／並立助詞／終助詞", "*", "*", "*", "*", "か", "カ", "カ"},
+			},
+			"majika",
+			true,
+		},
+		{
+			Sentence{
+				&Morph{"まじ", "名詞", "形容動詞語幹", "*", "*", "*", "*", "まじ", "マジ", "マジ"},
+				&Morph{"ｗ", "記号", "一般", "*", "*", "*", "*", "*", "", ""},
+			},
+			"",
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+		romaji, ok := test.sentence.Romaji()
+		if ok != test.ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+		if romaji != test.romaji {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.romaji, romaji)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the number of events per key in a sliding window.
+type RateLimiter struct {
+	limit  int // max events in window. If limit <= 0, there is no limit.
+	window time.Duration
+	mu     *sync.Mutex
+	events map[string][]time.Time
+}
+
+// NewRateLimiter returns new RateLimiter.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:  limit,
+		window: window,
+		mu:     new(sync.Mutex),
+		events: map[string][]time.Time{},
+	}
+}
+
+// Ready returns whether an event of key can occur at now.
+func (rl *RateLimiter) Ready(key string, now time.Time) bool {
+	if rl.limit <= 0 {
+		return true
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return len(rl.expire(key, now)) < rl.limit
+}
+
+// Record records an event of key at now.
+func (rl *RateLimiter) Record(key string, now time.Time) {
+	if rl.limit <= 0 {
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.events[key] = append(rl.expire(key, now), now)
+}
+
+// Allow records an event of key and returns true if it can occur at now.
+func (rl *RateLimiter) Allow(key string, now time.Time) bool {
+	if rl.limit <= 0 {
+		return true
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	events := rl.expire(key, now)
+	if len(events) >= rl.limit {
+		return false
+	}
+	rl.events[key] = append(events, now)
+	return true
+}
+
+// expire removes events out of window and returns rest events of key.
+func (rl *RateLimiter) expire(key string, now time.Time) []time.Time {
+	events := rl.events[key]
+	i := 0
+	for i < len(events) && now.Sub(events[i]) >= rl.window {
+		i++
+	}
+	events = events[i:]
+
+	if len(events) == 0 {
+		delete(rl.events, key)
+		return nil
+	}
+	rl.events[key] = events
+	return events
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		limit   int
+		window  time.Duration
+		keys    []string
+		offsets []time.Duration
+		allowed []bool
+	}{
+		{
+			2,
+			time.Minute,
+			[]string{"a", "a", "a", "b"},
+			[]time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second},
+			[]bool{true, true, false, true},
+		},
+		{
+			1,
+			time.Minute,
+			[]string{"a", "a", "a"},
+			[]time.Duration{0, 30 * time.Second, time.Minute},
+			[]bool{true, false, true},
+		},
+		{
+			0,
+			time.Minute,
+			[]string{"a", "a", "a"},
+			[]time.Duration{0, 0, 0},
+			[]bool{true, true, true},
+		},
+	}
+
+	for idx, test := range tests {
+		rl := NewRateLimiter(test.limit, test.window)
+		for i, key := range test.keys {
+			if allowed := rl.Allow(key, base.Add(test.offsets[i])); allowed != test.allowed[i] {
+				t.Errorf("[%d, %d] expected %v, but got %v", idx, i, test.allowed[i], allowed)
+			}
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/dghubble/go-twitter/twitter"
 )
@@ -22,19 +23,55 @@ var ChRandomSentence = make(chan Sentence, 10)
 // ChLyric is a stream of lyrics
 var ChLyric = make(chan Lyric, 5)
 
+// ChModeratedLyric is a stream of lyrics which passed moderation.
+var ChModeratedLyric = make(chan Lyric, 5)
+
+// analyzer analyzes tweets for learning and replies.
+var analyzer *Analyzer
+
 // markov is random sentence generator.
 var markov *Markov
 
+// moderator rejects NG lyrics.
+var moderator *Moderator
+
 // rapper is main rapper.
 var rapper *Rapper
 
 // lyricStorage is global lyricStorage
 var lyricStorage = NewLyricStorage(10000)
 
+// replyGuard limits replies.
+var replyGuard *ReplyGuard
+
+// outbox posts statuses.
+var outbox *Outbox
+
+// tweetFilter filters tweets to learn.
+var tweetFilter *TweetFilter
+
+// tweetRecorder records incoming tweets. It is nil if recording is disabled.
+var tweetRecorder *TweetRecorder
+
 // TwiClient is Twitter client
 var TwiClient *twitter.Client
 
 func main() {
+	if len(os.Args) > 1 {
+		// subcommands for lyrics from stdin
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			log.Fatal("unknown command: ", os.Args[1])
+		}
+		if err := LoadOptionalEnv(); err != nil {
+			log.Fatal(err)
+		}
+		if err := command(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := run(); err != nil {
 		log.Fatal(err)
 	}
@@ -52,14 +89,50 @@ func run() error {
 		return fmt.Errorf("cannot create markov: %w", err)
 	}
 	markov = NewMarkov(markovParams)
-	rapper, err = DefaultRapper()
+	analyzer, err = DefaultAnalyzer()
+	if err != nil {
+		return err
+	}
+	rapper, err = DefaultRapper(markov)
+	if err != nil {
+		return err
+	}
+	moderator, err = DefaultModerator()
+	if err != nil {
+		return err
+	}
+	defer moderator.Close()
+	replyGuard, err = DefaultReplyGuard()
+	if err != nil {
+		return err
+	}
+	tweetFilter, err = DefaultTweetFilter()
 	if err != nil {
 		return err
 	}
-	TwiClient = NewTwitterClient()
+	tweetRecorder, err = DefaultTweetRecorder()
+	if err != nil {
+		return err
+	}
+	if tweetRecorder != nil {
+		defer tweetRecorder.Close()
+	}
+	TwiClient = NewTwitterClient(tweetRecorder)
+	outbox, err = DefaultOutbox(TwiClient, lyricStorage)
+	if err != nil {
+		return err
+	}
+	defer outbox.Close()
 
 	// parse tweets
-	go JapaneseParseServer(ChTweetSentence, ChTweets)
+	go analyzer.JapaneseParseServer(ChTweetSentence, ChTweets)
+	if os.Getenv("USER_DIC_FILE") != "" {
+		reloadInterval, err := envIntDefault("USER_DIC_RELOAD_SECONDS", 60)
+		if err != nil {
+			return err
+		}
+		go analyzer.ReloadServer(time.Duration(reloadInterval) * time.Second)
+	}
 
 	// build markov chains
 	go markov.AddServer(ChTweetSentence)
@@ -74,37 +147,78 @@ func run() error {
 		return err
 	}
 
+	// moderate lyrics
+	go moderator.ModerateServer(ChModeratedLyric, ChLyric)
+
 	// store lyrics
-	go lyricStorage.PushServer(ChLyric)
+	go lyricStorage.PushServer(ChModeratedLyric)
+
+	done := make(chan struct{})
+	defer close(done)
 
 	// Twitter stream
-	streamSample, err := TwiClient.Streams.Sample(&twitter.StreamSampleParams{
-		StallWarnings: twitter.Bool(true),
-	})
+	filterStatsInterval, err := envIntDefault("LEARN_FILTER_STATS_MINUTES", 60)
 	if err != nil {
-		return fmt.Errorf("twitter sample error: %w", err)
+		return err
+	}
+	go tweetFilter.StatsServer(time.Duration(filterStatsInterval) * time.Minute)
+	var supervisors []*StreamSupervisor
+	if path := os.Getenv("REPLAY_FILE"); path != "" {
+		speed, err := envFloatDefault("REPLAY_SPEED", 1.0)
+		if err != nil {
+			return err
+		}
+		go func() {
+			handlers := map[string]func(*twitter.Tweet){
+				"sample": ReplayTweet,
+				"reply":  ServeReply,
+			}
+			if err := ReplayFile(path, handlers, speed); err != nil {
+				log.Println(err)
+			}
+			log.Println("replay finished")
+		}()
+	} else {
+		sampleStream, err := DefaultStreamSupervisor("sample", func() (*twitter.Stream, error) {
+			return TwiClient.Streams.Sample(&twitter.StreamSampleParams{
+				StallWarnings: twitter.Bool(true),
+			})
+		}, ExtractTweet, true)
+		if err != nil {
+			return err
+		}
+		go sampleStream.Serve(done)
+		supervisors = append(supervisors, sampleStream)
 	}
-	defer streamSample.Stop()
-	demuxSample := twitter.NewSwitchDemux()
-	demuxSample.Tweet = ExtractTweet
-	go demuxSample.HandleChan(streamSample.Messages)
-	// TODO
+
+	// post statuses
+	go outbox.PostServer()
 
 	// regular tweet
-	LaunchRegularTweetServer()
+	if err := LaunchRegularTweetServer(); err != nil {
+		return err
+	}
 
 	// serve twitter reply
-	streamReply, err := TwiClient.Streams.Filter(&twitter.StreamFilterParams{
-		Track:         []string{os.Getenv("TWITTER_SCREENNAME")},
-		StallWarnings: twitter.Bool(true),
-	})
+	go replyGuard.ReplyServer(reply)
+	replyStream, err := DefaultStreamSupervisor("reply", func() (*twitter.Stream, error) {
+		return TwiClient.Streams.Filter(&twitter.StreamFilterParams{
+			Track:         []string{os.Getenv("TWITTER_SCREENNAME")},
+			StallWarnings: twitter.Bool(true),
+		})
+	}, ServeReply, false)
 	if err != nil {
-		return fmt.Errorf("twitter filter reply error: %w", err)
+		return err
+	}
+	go replyStream.Serve(done)
+	supervisors = append(supervisors, replyStream)
+
+	// watch stream health
+	healthInterval, err := envIntDefault("STREAM_HEALTH_CHECK_SECONDS", 60)
+	if err != nil {
+		return err
 	}
-	defer streamReply.Stop()
-	demuxReply := twitter.NewSwitchDemux()
-	demuxReply.Tweet = ServeReply
-	go demuxReply.HandleChan(streamReply.Messages)
+	go StreamHealthServer(time.Duration(healthInterval)*time.Second, supervisors...)
 
 	// signal handling
 	chSig := make(chan os.Signal, 1)
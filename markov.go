@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // MarkovParams is a parameter of a markov chain.
@@ -14,6 +16,23 @@ type MarkovParams struct {
 	Ngram          int // ngram (n >= 2).
 	ChainNum       int // max number of markov chains.
 	ChainMorphsNum int // max number of morphemes which each chain has.
+	MaxCopyMorphs  int // max consecutive morphemes copied from a learned sentence. 0 means no limit.
+	CopyHistory    int // number of learned sentences checked for copies.
+
+	// HalfLife is the half-life of ngram weights. If it is positive, a single
+	// chain decays instead of rotating chains: it is decayed and published
+	// every ChainMorphsNum ngrams, and Ready is closed after ChainNum
+	// publications. Morphs are chosen in proportion to their weights only in
+	// this mode or with back-off. Otherwise they are chosen uniformly.
+	HalfLife  time.Duration
+	MinWeight float64 // ngrams lighter than MinWeight are pruned on decay.
+
+	// BackoffWeights enable back-off to shorter contexts. Each weight is
+	// the discount subtracted from ngram weights of an order, from Ngram
+	// down to bigrams, and the discounted probability goes to shorter
+	// contexts as in Kneser-Ney. The last weight is used for the rest of
+	// orders. Empty means no back-off.
+	BackoffWeights []float64
 }
 
 // DefaultMarkovParams uses .env values.
@@ -30,11 +49,40 @@ func DefaultMarkovParams() (*MarkovParams, error) {
 	if err != nil {
 		return nil, err
 	}
+	maxCopyMorphs, err := envIntDefault("MAX_COPY_MORPHS", 0)
+	if err != nil {
+		return nil, err
+	}
+	copyHistory, err := envIntDefault("COPY_HISTORY", 100000)
+	if err != nil {
+		return nil, err
+	}
+	halfLife, err := envIntDefault("CHAIN_HALF_LIFE_MINUTES", 0)
+	if err != nil {
+		return nil, err
+	}
+	minWeight, err := envFloatDefault("CHAIN_MIN_WEIGHT", 0.5)
+	if err != nil {
+		return nil, err
+	}
+	var backoffWeights []float64
+	for _, str := range envListDefault("BACKOFF_WEIGHTS", nil) {
+		val, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKOFF_WEIGHTS: %w", err)
+		}
+		backoffWeights = append(backoffWeights, val)
+	}
 
 	return &MarkovParams{
 		Ngram:          ngram,
 		ChainNum:       chainNum,
 		ChainMorphsNum: chainMorphsNum,
+		MaxCopyMorphs:  maxCopyMorphs,
+		CopyHistory:    copyHistory,
+		HalfLife:       time.Duration(halfLife) * time.Minute,
+		MinWeight:      minWeight,
+		BackoffWeights: backoffWeights,
 	}, nil
 }
 
@@ -47,23 +95,57 @@ func envAtoiErr(name string) (int, error) {
 }
 
 // Markov has Markov chains. It can generate random sentences.
+//
+// Learned chains are published as an immutable snapshot which is swapped
+// atomically, so generation never blocks learning and vice versa.
 type Markov struct {
 	once     *sync.Once
 	Ready    chan struct{} // close ready when learning completed.
 	params   *MarkovParams
-	learning chain // under learning chain
-	mu       *sync.RWMutex
-	chains   []chain // Markov chains
+	vocab    *vocabulary   // morphs of learning and published chains
+	learning *chain        // under learning chain
+	snapshot *atomic.Value // published *markovSnapshot. It is never modified.
+	guard    *CopyGuard    // rejects copies of learned sentences. It may be nil.
+
+	generation uint64 // number of publications
+
+	// vocabLen is the size of vocab when it is compacted last. vocab is
+	// compacted when it doubles, so it keeps morphs of rotated or pruned
+	// ngrams at most as many as the live ones.
+	vocabLen int
+
+	// states of decay mode
+	decayedAt time.Time // when learning is decayed last
+	added     int       // ngrams added since decayedAt
+	published int       // number of publications
+}
+
+// markovSnapshot is published chains and the vocabulary of their IDs.
+type markovSnapshot struct {
+	chains     []*chain
+	vocab      *vocabulary
+	generation uint64 // number of publications
 }
 
 // NewMarkov returns new Markov.
 func NewMarkov(params *MarkovParams) *Markov {
+	var guard *CopyGuard
+	if params.MaxCopyMorphs > 0 {
+		guard = NewCopyGuard(params.MaxCopyMorphs, params.CopyHistory)
+	}
+
+	vocab := newVocabulary()
+	snapshot := new(atomic.Value)
+	snapshot.Store(&markovSnapshot{vocab: vocab})
 	return &Markov{
 		once:     new(sync.Once),
 		Ready:    make(chan struct{}),
 		params:   params,
-		learning: make(chain),
-		mu:       new(sync.RWMutex),
+		vocab:    vocab,
+		learning: newChain(),
+		snapshot: snapshot,
+		guard:    guard,
+		vocabLen: vocab.Len(),
 	}
 }
 
@@ -77,29 +159,130 @@ func (m *Markov) AddServer(ch <-chan Sentence) {
 // Add adds sentence to Markov learning chain. This function cannot be called
 // concurrently.
 func (m *Markov) Add(sentence Sentence) {
+	m.add(sentence, time.Now())
+}
+
+// add adds sentence learned at now.
+func (m *Markov) add(sentence Sentence, now time.Time) {
+	if m.guard != nil {
+		m.guard.Add(sentence)
+	}
+
 	for i := 0; i < len(sentence)-m.params.Ngram+1; i++ {
-		morphs := sentence[i : i+m.params.Ngram]
-		m.learning.Add(morphs)
+		ids := m.vocab.internAll(sentence[i : i+m.params.Ngram])
+
+		if m.params.HalfLife <= 0 {
+			m.learning.Add(ids, 1)
+			if m.learning.Len() >= m.params.ChainMorphsNum {
+				m.shiftChain()
+			}
+			continue
+		}
 
-		if len(m.learning) >= m.params.ChainMorphsNum {
-			m.shiftChain()
+		if m.decayedAt.IsZero() {
+			m.decayedAt = now
+		}
+		// Decay before weights of new ngrams overflow float32.
+		if now.Sub(m.decayedAt) > maxDecayHalfLives*m.params.HalfLife {
+			m.decay(now)
+		}
+		// Weights are relative to decayedAt, so that newer ngrams are
+		// heavier and every ngram has the right weight after decay.
+		m.learning.Add(ids, float32(1/m.decayFactor(m.decayedAt, now)))
+		if m.added++; m.added >= m.params.ChainMorphsNum {
+			m.decay(now)
 		}
 	}
 }
 
 // shiftChain shift Markov chains and initialize learning.
 func (m *Markov) shiftChain() {
-	m.mu.Lock()
-	if len(m.chains) >= m.params.ChainNum {
-		m.chains = m.chains[1:]
+	chains := m.loadChains()
+	if len(chains) >= m.params.ChainNum {
+		chains = chains[1:]
+	}
+	m.publish(append(chains[:len(chains):len(chains)], m.learning))
+	if len(chains)+1 >= m.params.ChainNum {
+		m.once.Do(func() { close(m.Ready) })
 	}
-	m.chains = append(m.chains, m.learning)
-	if len(m.chains) >= m.params.ChainNum {
+
+	m.learning = newChain()
+}
+
+// maxDecayHalfLives is the max number of half-lives between decays. Weights
+// of new ngrams are up to 2^maxDecayHalfLives.
+const maxDecayHalfLives = 32
+
+// weighted returns whether morphs are chosen in proportion to their weights.
+func (m *Markov) weighted() bool {
+	return m.params.HalfLife > 0 || len(m.params.BackoffWeights) > 0
+}
+
+// decayFactor returns how much weights decay from since to now.
+func (m *Markov) decayFactor(since, now time.Time) float64 {
+	return math.Exp2(-float64(now.Sub(since)) / float64(m.params.HalfLife))
+}
+
+// decay decays and prunes learning at now, and publishes it.
+func (m *Markov) decay(now time.Time) {
+	decayed := m.learning.Decay(float32(m.decayFactor(m.decayedAt, now)), float32(m.params.MinWeight))
+	m.publish([]*chain{decayed})
+	if m.published++; m.published >= m.params.ChainNum {
 		m.once.Do(func() { close(m.Ready) })
 	}
-	m.mu.Unlock()
 
-	m.learning = make(chain)
+	// decayed may be remapped by publish
+	m.learning = m.loadChains()[0].Clone()
+	m.decayedAt = now
+	m.added = 0
+}
+
+// publish replaces the chains with chains, which must not be modified
+// afterward. Back-off of new chains is built if needed. Morphs which no
+// chain has may be removed from the vocabulary, and then chains are
+// published with new IDs, so the learning chain must be replaced with a new
+// one or a published one.
+func (m *Markov) publish(chains []*chain) {
+	if len(m.params.BackoffWeights) > 0 {
+		for _, c := range chains {
+			if c.backoff == nil {
+				c.BuildBackoff(m.params.Ngram)
+			}
+		}
+	}
+	if m.vocab.Len() > 2*m.vocabLen {
+		chains = m.compact(chains)
+	}
+	m.generation++
+	m.snapshot.Store(&markovSnapshot{chains: chains, vocab: m.vocab, generation: m.generation})
+}
+
+// compact replaces the vocabulary with the one which has only morphs of
+// chains, and returns chains with new IDs.
+func (m *Markov) compact(chains []*chain) []*chain {
+	live := make([]bool, m.vocab.Len())
+	for _, c := range chains {
+		c.markIDs(live)
+	}
+	vocab, newIDs := m.vocab.compact(live)
+
+	remapped := make([]*chain, len(chains))
+	for i, c := range chains {
+		remapped[i] = c.Remap(newIDs)
+	}
+	m.vocab = vocab
+	m.vocabLen = vocab.Len()
+	return remapped
+}
+
+// loadSnapshot returns the current snapshot. It must not be modified.
+func (m *Markov) loadSnapshot() *markovSnapshot {
+	return m.snapshot.Load().(*markovSnapshot)
+}
+
+// loadChains returns the current chains. They must not be modified.
+func (m *Markov) loadChains() []*chain {
+	return m.loadSnapshot().chains
 }
 
 // RandomSentenceServer generate random sentence forever.
@@ -113,119 +296,306 @@ func (m *Markov) RandomSentenceServer(chSentence chan<- Sentence, morphLen int)
 	}
 }
 
-// LaunchRandomSentenceServer launch multi RandomSentenceServer
+// RandomMoraSentenceServer generate random sentence of moraLen morae forever.
+func (m *Markov) RandomMoraSentenceServer(chSentence chan<- Sentence, moraLen int) {
+	for {
+		sentence, ok := m.RandomMoraSentence(moraLen)
+		if !ok {
+			continue
+		}
+		chSentence <- sentence
+	}
+}
+
+// LaunchRandomSentenceServer launch multi RandomSentenceServer and
+// RandomMoraSentenceServer.
 func (m *Markov) LaunchRandomSentenceServer(chSentence chan<- Sentence) error {
 	var morphLens []int
-	for _, str := range strings.Split(os.Getenv("RANDOM_MORPH_LEN"), ",") {
+	for _, str := range envListDefault("RANDOM_MORPH_LEN", nil) {
 		val, err := strconv.Atoi(str)
 		if err != nil {
 			return fmt.Errorf("invalid RANDOM_MORPH_LEN")
 		}
 		morphLens = append(morphLens, val)
 	}
+	var moraLens []int
+	for _, str := range envListDefault("RANDOM_MORA_LEN", nil) {
+		val, err := strconv.Atoi(str)
+		if err != nil {
+			return fmt.Errorf("invalid RANDOM_MORA_LEN")
+		}
+		moraLens = append(moraLens, val)
+	}
+	if len(morphLens)+len(moraLens) == 0 {
+		return fmt.Errorf("no RANDOM_MORPH_LEN or RANDOM_MORA_LEN")
+	}
 
 	for _, morphLen := range morphLens {
 		go func(morphLen int) {
-			<-markov.Ready
-			markov.RandomSentenceServer(chSentence, morphLen)
+			<-m.Ready
+			m.RandomSentenceServer(chSentence, morphLen)
 		}(morphLen)
 	}
+	for _, moraLen := range moraLens {
+		go func(moraLen int) {
+			<-m.Ready
+			m.RandomMoraSentenceServer(chSentence, moraLen)
+		}(moraLen)
+	}
 	return nil
 }
 
 // RandomSentence generates random sentence
 func (m *Markov) RandomSentence(morphLen int) (sentence Sentence, ok bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	// generate head of sentence
-	sentence = []*Morph{&BOS}
-	for i := 0; i < m.params.Ngram-2; i++ {
-		var morph *Morph
-		morph, ok = m.RandomMorph(sentence)
+	return m.randomSentence(func(sentence Sentence, morph *Morph) bool {
+		return len(sentence) >= morphLen
+	})
+}
+
+// RandomMoraSentence generates random sentence toward moraLen morae.
+// The sentence may have a few more morae than moraLen because morphs are not
+// split. Unpronounceable sentence will not be generated.
+func (m *Markov) RandomMoraSentence(moraLen int) (sentence Sentence, ok bool) {
+	var count int
+	pronounceable := true
+	sentence, ok = m.randomSentence(func(sentence Sentence, morph *Morph) bool {
+		morae, ok := morph.Morae()
 		if !ok {
-			return
+			pronounceable = false
+			return true
 		}
-		sentence = append(sentence, morph)
+		count += len(morae)
+		return count >= moraLen
+	})
+	if !pronounceable {
+		return nil, false
 	}
+	return
+}
+
+// randomSentence generates random sentence. full is called with the sentence
+// (without BOS) after morph is appended, and the generation stops when it
+// returns true.
+func (m *Markov) randomSentence(full func(sentence Sentence, morph *Morph) bool) (sentence Sentence, ok bool) {
+	snapshot := m.loadSnapshot()
 
-	for len(sentence) < morphLen+1 {
-		var morph *Morph
-		morph, ok = m.RandomMorph(sentence[len(sentence)-m.params.Ngram+1:])
+	ids := []morphID{bosID}
+	for done := false; !done; {
+		context := ids
+		if len(context) > m.params.Ngram-1 {
+			context = context[len(context)-m.params.Ngram+1:]
+		}
+		id, ok := m.randomID(snapshot.chains, context)
 		if !ok {
-			return
+			return nil, false
 		}
-		if *morph == EOS {
+		if id == eosID {
 			break
 		}
+		ids = append(ids, id)
+		morph := snapshot.vocab.morph(id)
 		sentence = append(sentence, morph)
+		done = full(sentence, morph)
 	}
 
-	return sentence[1:], true
+	if m.guard != nil && m.guard.IsCopied(sentence) {
+		return nil, false
+	}
+	return sentence, true
 }
 
 // RandomMorph find random morph from all chains.
 func (m *Markov) RandomMorph(morphs []*Morph) (morph *Morph, ok bool) {
-	for _, idx := range randomIndice(len(m.chains)) {
-		chain := m.chains[idx]
-		morph, ok = chain.RandomMorph(morphs)
-		if !ok {
+	snapshot := m.loadSnapshot()
+	ids, ok := snapshot.vocab.idsOf(morphs)
+	if !ok {
+		return nil, false
+	}
+	id, ok := m.randomID(snapshot.chains, ids)
+	if !ok {
+		return nil, false
+	}
+	return snapshot.vocab.morph(id), true
+}
+
+// randomID finds random morph ID which follows ids from chains. If back-off
+// is enabled, shorter contexts are tried with the discounted probability or
+// when no chain has ids.
+func (m *Markov) randomID(chains []*chain, ids []morphID) (id morphID, ok bool) {
+	indice := randomIndice(len(chains))
+	for length := len(ids); length >= 0; length-- {
+		order := len(ids) - length // 0 is the longest context
+		if order > 0 && len(m.params.BackoffWeights) == 0 {
+			break
+		}
+		discount := m.discount(order, length)
+
+		for _, idx := range indice {
+			c := m.level(chains[idx], order, length)
+			if c == nil {
+				continue
+			}
+			if !m.weighted() {
+				if id, ok = c.randomUniformID(ids); ok {
+					return id, true
+				}
+				continue
+			}
+			var backoff bool
+			id, backoff, ok = c.randomDiscountedID(ids[order:], discount)
+			if ok {
+				return id, true
+			}
+			if backoff {
+				break
+			}
+		}
+	}
+	return 0, false
+}
+
+// prob returns the probability that randomID(chains, ids) chooses next
+// after the first length morphs of ids are dropped.
+func (m *Markov) prob(chains []*chain, ids []morphID, next morphID, length int) float64 {
+	order := len(ids) - length
+	if length < 0 || order > 0 && len(m.params.BackoffWeights) == 0 {
+		return 0
+	}
+	discount := m.discount(order, length)
+
+	var sum float64
+	var num int
+	lower := -1.0 // probability of the shorter context, calculated lazily
+	for _, c := range chains {
+		if c = m.level(c, order, length); c == nil {
+			continue
+		}
+		edges := c.edges(ids[order:])
+		if len(edges) == 0 {
+			continue
+		}
+		if !m.weighted() {
+			for _, edge := range edges {
+				if edge.id == next {
+					sum += 1 / float64(len(edges))
+				}
+			}
+			num++
 			continue
 		}
-		return
+
+		var total, kept, weight float64
+		for _, edge := range edges {
+			w := math.Max(float64(edge.weight)-discount, 0)
+			total += float64(edge.weight)
+			kept += w
+			if edge.id == next {
+				weight = w
+			}
+		}
+		p := weight / total
+		if discount > 0 && kept < total {
+			if lower < 0 {
+				lower = m.prob(chains, ids, next, length-1)
+			}
+			p += (total - kept) / total * lower
+		}
+		sum += p
+		num++
 	}
+	if num == 0 {
+		return m.prob(chains, ids, next, length-1)
+	}
+	return sum / float64(num)
+}
 
-	return
+// discount returns the discount of weights for the context of length morphs
+// which is shorter by order than the longest context.
+func (m *Markov) discount(order, length int) float64 {
+	weights := m.params.BackoffWeights
+	if length == 0 || len(weights) == 0 {
+		return 0
+	}
+	if order < len(weights) {
+		return weights[order]
+	}
+	return weights[len(weights)-1]
 }
 
-// randomIndice generate random indice.
-func randomIndice(num int) []int {
-	indice := make([]int, num)
-	for i := 0; i < num; i++ {
-		indice[i] = i
+// level returns the chain for the context which is shorter by order than
+// the longest context, or nil if c has no such chain.
+func (m *Markov) level(c *chain, order, length int) *chain {
+	if order == 0 {
+		return c
 	}
-	for i := num - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
-		indice[i], indice[j] = indice[j], indice[i]
+	// ngrams of length+1 morphs
+	if length >= len(c.backoff) {
+		return nil
 	}
-	return indice
+	return c.backoff[length]
 }
 
-// chain is a markov chain map.
-type chain map[Morph]chain
+// LogProb returns the natural log probability that the current chains
+// generate sentence. EOS is not included because generated sentences may be
+// cut in the middle. ok is false if the chains cannot generate sentence.
+func (m *Markov) LogProb(sentence Sentence) (logProb float64, ok bool) {
+	snapshot := m.loadSnapshot()
+	ids, ok := snapshot.vocab.idsOf(trimBOSEOS(sentence))
+	if !ok || len(ids) == 0 {
+		return 0, false
+	}
+	ids = append([]morphID{bosID}, ids...)
 
-// Add adds morphs recursively.
-func (c *chain) Add(morphs []*Morph) {
-	if len(morphs) == 0 {
-		return
+	chains := snapshot.chains
+	for i := 1; i < len(ids); i++ {
+		start := i - m.params.Ngram + 1
+		if start < 0 {
+			start = 0
+		}
+		p := m.prob(chains, ids[start:i], ids[i], i-start)
+		if p <= 0 {
+			return 0, false
+		}
+		logProb += math.Log(p)
 	}
+	return logProb, true
+}
 
-	next, ok := (*c)[*morphs[0]]
+// Perplexity returns the perplexity of sentence per morph. ok is false if
+// the chains cannot generate sentence.
+func (m *Markov) Perplexity(sentence Sentence) (perplexity float64, ok bool) {
+	logProb, ok := m.LogProb(sentence)
 	if !ok {
-		next = make(chain)
-		(*c)[*morphs[0]] = next
+		return 0, false
 	}
+	return math.Exp(-logProb / float64(len(trimBOSEOS(sentence)))), true
+}
 
-	(&next).Add(morphs[1:])
+// Fluency returns the inverse of the perplexity of sentence between 0 and 1.
+// It is 0 if the chains cannot generate sentence.
+func (m *Markov) Fluency(sentence Sentence) float64 {
+	perplexity, ok := m.Perplexity(sentence)
+	if !ok {
+		return 0
+	}
+	return 1 / perplexity
 }
 
-// RandomMorph returns random Morph from morphs.
-func (c chain) RandomMorph(morphs []*Morph) (morph *Morph, ok bool) {
-	if len(morphs) == 0 {
-		for m := range c {
-			morph = &m
-			ok = true
-			return
-		}
+// Generation returns the number of publications. Fluency of sentences may
+// change when it changes.
+func (m *Markov) Generation() uint64 {
+	return m.loadSnapshot().generation
+}
 
-		// cannot reach this code
-		panic("chain has no entry")
+// randomIndice generate random indice.
+func randomIndice(num int) []int {
+	indice := make([]int, num)
+	for i := 0; i < num; i++ {
+		indice[i] = i
 	}
-
-	var next chain
-	next, ok = c[*morphs[0]]
-	if !ok {
-		return
+	for i := num - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		indice[i], indice[j] = indice[j], indice[i]
 	}
-	return next.RandomMorph(morphs[1:])
+	return indice
 }
@@ -1,17 +1,103 @@
 package main
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
 	"reflect"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
+// mapChain is the former markov chain, a map of Morphs. Tests write chains
+// with it, and benchmarks compare chain with it.
+type mapChain map[Morph]mapChain
+
+// Add adds morphs recursively.
+func (c mapChain) Add(morphs []*Morph) {
+	if len(morphs) == 0 {
+		return
+	}
+	next, ok := c[*morphs[0]]
+	if !ok {
+		next = make(mapChain)
+		c[*morphs[0]] = next
+	}
+	next.Add(morphs[1:])
+}
+
+// RandomMorph returns random Morph which follows morphs.
+func (c mapChain) RandomMorph(morphs []*Morph) (morph *Morph, ok bool) {
+	if len(morphs) == 0 {
+		for m := range c {
+			return &m, true
+		}
+		return nil, false
+	}
+	next, ok := c[*morphs[0]]
+	if !ok {
+		return nil, false
+	}
+	return next.RandomMorph(morphs[1:])
+}
+
+// chain converts c into chain.
+func (c mapChain) chain(v *vocabulary) *chain {
+	ch := newChain()
+	var add func(c mapChain, ids []morphID)
+	add = func(c mapChain, ids []morphID) {
+		if len(c) == 0 && len(ids) > 0 {
+			ch.Add(ids, 1)
+		}
+		for m, next := range c {
+			m := m
+			add(next, append(ids[:len(ids):len(ids)], v.intern(&m)))
+		}
+	}
+	add(c, nil)
+	return ch
+}
+
+// mapChain converts c into mapChain.
+func (c *chain) mapChain(v *vocabulary) mapChain {
+	var convert func(node int32) mapChain
+	convert = func(node int32) mapChain {
+		mc := mapChain{}
+		for _, edge := range c.nodes[node].edges {
+			next := mapChain{}
+			if edge.next >= 0 {
+				next = convert(edge.next)
+			}
+			mc[*v.morph(edge.id)] = next
+		}
+		return mc
+	}
+	return convert(0)
+}
+
+// newTestMarkov returns Markov which has chains.
+func newTestMarkov(params *MarkovParams, chains []mapChain) *Markov {
+	if params == nil {
+		params = &MarkovParams{}
+	}
+	m := NewMarkov(params)
+	var compacts []*chain
+	for _, c := range chains {
+		compacts = append(compacts, c.chain(m.vocab))
+	}
+	m.publish(compacts)
+	return m
+}
+
 func TestMarkov_Add(t *testing.T) {
 	tests := []struct {
 		morphss  [][]*Morph
 		params   *MarkovParams
-		learning chain
-		chains   []chain
+		learning mapChain
+		chains   []mapChain
 	}{
 		{
 			[][]*Morph{
@@ -28,18 +114,18 @@ func TestMarkov_Add(t *testing.T) {
 				ChainNum:       2,
 				ChainMorphsNum: 5,
 			},
-			chain{
-				Morph{"BOS", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: chain{},
+			mapChain{
+				Morph{"BOS", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: mapChain{},
 				},
-				Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: chain{
-					Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{},
+				Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: mapChain{
+					Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{},
 				},
-				Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{
-					Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: chain{},
+				Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{
+					Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: mapChain{},
 				},
-				Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: chain{
-					Morph{"EOS", "", "", "", "", "", "", "", "", ""}: chain{},
+				Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: mapChain{
+					Morph{"EOS", "", "", "", "", "", "", "", "", ""}: mapChain{},
 				},
 			},
 			nil,
@@ -59,20 +145,20 @@ func TestMarkov_Add(t *testing.T) {
 				ChainNum:       2,
 				ChainMorphsNum: 5,
 			},
-			chain{
-				Morph{"BOS", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: chain{
-						Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{},
+			mapChain{
+				Morph{"BOS", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: mapChain{
+						Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{},
 					},
 				},
-				Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: chain{
-					Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{
-						Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: chain{},
+				Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: mapChain{
+					Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{
+						Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: mapChain{},
 					},
 				},
-				Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{
-					Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: chain{
-						Morph{"EOS", "", "", "", "", "", "", "", "", ""}: chain{},
+				Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{
+					Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: mapChain{
+						Morph{"EOS", "", "", "", "", "", "", "", "", ""}: mapChain{},
 					},
 				},
 			},
@@ -93,23 +179,23 @@ func TestMarkov_Add(t *testing.T) {
 				ChainNum:       2,
 				ChainMorphsNum: 2,
 			},
-			chain{
-				Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{
-					Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: chain{
-						Morph{"EOS", "", "", "", "", "", "", "", "", ""}: chain{},
+			mapChain{
+				Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{
+					Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: mapChain{
+						Morph{"EOS", "", "", "", "", "", "", "", "", ""}: mapChain{},
 					},
 				},
 			},
-			[]chain{
-				chain{
-					Morph{"BOS", "", "", "", "", "", "", "", "", ""}: chain{
-						Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: chain{
-							Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{},
+			[]mapChain{
+				mapChain{
+					Morph{"BOS", "", "", "", "", "", "", "", "", ""}: mapChain{
+						Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: mapChain{
+							Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{},
 						},
 					},
-					Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: chain{
-						Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{
-							Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: chain{},
+					Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: mapChain{
+						Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{
+							Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: mapChain{},
 						},
 					},
 				},
@@ -136,26 +222,26 @@ func TestMarkov_Add(t *testing.T) {
 				ChainNum:       2,
 				ChainMorphsNum: 2,
 			},
-			chain{
-				Morph{"さん", "名詞", "接尾", "人名", "*", "*", "*", "さん", "サン", "サン"}: chain{
-					Morph{"EOS", "", "", "", "", "", "", "", "", ""}: chain{},
+			mapChain{
+				Morph{"さん", "名詞", "接尾", "人名", "*", "*", "*", "さん", "サン", "サン"}: mapChain{
+					Morph{"EOS", "", "", "", "", "", "", "", "", ""}: mapChain{},
 				},
 			},
-			[]chain{
-				chain{
-					Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: chain{
-						Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: chain{},
+			[]mapChain{
+				mapChain{
+					Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}: mapChain{
+						Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: mapChain{},
 					},
-					Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: chain{
-						Morph{"EOS", "", "", "", "", "", "", "", "", ""}: chain{},
+					Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}: mapChain{
+						Morph{"EOS", "", "", "", "", "", "", "", "", ""}: mapChain{},
 					},
 				},
-				chain{
-					Morph{"BOS", "", "", "", "", "", "", "", "", ""}: chain{
-						Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: chain{},
+				mapChain{
+					Morph{"BOS", "", "", "", "", "", "", "", "", ""}: mapChain{
+						Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: mapChain{},
 					},
-					Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: chain{
-						Morph{"さん", "名詞", "接尾", "人名", "*", "*", "*", "さん", "サン", "サン"}: chain{},
+					Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}: mapChain{
+						Morph{"さん", "名詞", "接尾", "人名", "*", "*", "*", "さん", "サン", "サン"}: mapChain{},
 					},
 				},
 			},
@@ -167,11 +253,15 @@ func TestMarkov_Add(t *testing.T) {
 		for _, morphs := range test.morphss {
 			m.Add(morphs)
 		}
-		if !reflect.DeepEqual(test.learning, m.learning) {
-			t.Errorf("[%d] learning: expected\n%v, but got\n%v", idx, test.learning, m.learning)
+		if learning := m.learning.mapChain(m.vocab); !reflect.DeepEqual(test.learning, learning) {
+			t.Errorf("[%d] learning: expected\n%v, but got\n%v", idx, test.learning, learning)
 		}
-		if !reflect.DeepEqual(test.chains, m.chains) {
-			t.Errorf("[%d] chains: expected\n%v, but got\n%v", idx, test.chains, m.chains)
+		var chains []mapChain
+		for _, c := range m.loadChains() {
+			chains = append(chains, c.mapChain(m.vocab))
+		}
+		if !reflect.DeepEqual(test.chains, chains) {
+			t.Errorf("[%d] chains: expected\n%v, but got\n%v", idx, test.chains, chains)
 		}
 	}
 }
@@ -179,33 +269,32 @@ func TestMarkov_Add(t *testing.T) {
 func TestMarkov_RandomSentence(t *testing.T) {
 	tests := []struct {
 		morphLen int
-		markov   Markov
+		markov   *Markov
 		sentence Sentence
 	}{
 		{
 			3,
-			Markov{
-				params: &MarkovParams{
+			newTestMarkov(
+				&MarkovParams{
 					Ngram: 2,
 				},
-				mu: new(sync.RWMutex),
-				chains: []chain{
-					chain{
-						Morph{"BOS", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"あ", "", "", "", "", "", "", "", "", ""}: chain{},
+				[]mapChain{
+					mapChain{
+						Morph{"BOS", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"あ", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
-						Morph{"あ", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{},
+						Morph{"あ", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
-						Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{},
+						Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
-						Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"え", "", "", "", "", "", "", "", "", ""}: chain{},
+						Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"え", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
 					},
 				},
-			},
+			),
 			Sentence{
 				&Morph{"あ", "", "", "", "", "", "", "", "", ""},
 				&Morph{"い", "", "", "", "", "", "", "", "", ""},
@@ -214,28 +303,27 @@ func TestMarkov_RandomSentence(t *testing.T) {
 		},
 		{
 			3,
-			Markov{
-				params: &MarkovParams{
+			newTestMarkov(
+				&MarkovParams{
 					Ngram: 2,
 				},
-				mu: new(sync.RWMutex),
-				chains: []chain{
-					chain{
-						Morph{"BOS", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"あ", "", "", "", "", "", "", "", "", ""}: chain{},
+				[]mapChain{
+					mapChain{
+						Morph{"BOS", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"あ", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
-						Morph{"あ", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{},
+						Morph{"あ", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
-						Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{
-							EOS: chain{},
+						Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{
+							EOS: mapChain{},
 						},
-						Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"え", "", "", "", "", "", "", "", "", ""}: chain{},
+						Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"え", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
 					},
 				},
-			},
+			),
 			Sentence{
 				&Morph{"あ", "", "", "", "", "", "", "", "", ""},
 				&Morph{"い", "", "", "", "", "", "", "", "", ""},
@@ -254,27 +342,28 @@ func TestMarkov_RandomSentence(t *testing.T) {
 func TestMarkov_ChoiceMorph(t *testing.T) {
 	tests := []struct {
 		morphs []*Morph
-		markov Markov
+		markov *Markov
 		morph  *Morph
 	}{
 		{
 			[]*Morph{
 				&Morph{"あ", "", "", "", "", "", "", "", "", ""},
 			},
-			Markov{
-				chains: []chain{
-					chain{
-						Morph{"あ", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{},
+			newTestMarkov(
+				nil,
+				[]mapChain{
+					mapChain{
+						Morph{"あ", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
 					},
-					chain{
-						Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"え", "", "", "", "", "", "", "", "", ""}: chain{},
+					mapChain{
+						Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"え", "", "", "", "", "", "", "", "", ""}: mapChain{},
 						},
 					},
 				},
-			},
+			),
 			&Morph{"い", "", "", "", "", "", "", "", "", ""},
 		},
 		{
@@ -282,29 +371,30 @@ func TestMarkov_ChoiceMorph(t *testing.T) {
 				&Morph{"あ", "", "", "", "", "", "", "", "", ""},
 				&Morph{"い", "", "", "", "", "", "", "", "", ""},
 			},
-			Markov{
-				chains: []chain{
-					chain{
-						Morph{"あ", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{
-								Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{},
+			newTestMarkov(
+				nil,
+				[]mapChain{
+					mapChain{
+						Morph{"あ", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{
+								Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{},
 							},
-							Morph{"え", "", "", "", "", "", "", "", "", ""}: chain{
-								Morph{"お", "", "", "", "", "", "", "", "", ""}: chain{},
-								Morph{"か", "", "", "", "", "", "", "", "", ""}: chain{},
+							Morph{"え", "", "", "", "", "", "", "", "", ""}: mapChain{
+								Morph{"お", "", "", "", "", "", "", "", "", ""}: mapChain{},
+								Morph{"か", "", "", "", "", "", "", "", "", ""}: mapChain{},
 							},
 						},
 					},
-					chain{
-						Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{
-							Morph{"え", "", "", "", "", "", "", "", "", ""}: chain{
-								Morph{"お", "", "", "", "", "", "", "", "", ""}: chain{},
-								Morph{"か", "", "", "", "", "", "", "", "", ""}: chain{},
+					mapChain{
+						Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{
+							Morph{"え", "", "", "", "", "", "", "", "", ""}: mapChain{
+								Morph{"お", "", "", "", "", "", "", "", "", ""}: mapChain{},
+								Morph{"か", "", "", "", "", "", "", "", "", ""}: mapChain{},
 							},
 						},
 					},
 				},
-			},
+			),
 			&Morph{"う", "", "", "", "", "", "", "", "", ""},
 		},
 	}
@@ -330,7 +420,7 @@ func TestRandomIndice(t *testing.T) {
 func TestChain_Add(t *testing.T) {
 	tests := []struct {
 		morphss [][]*Morph
-		c       chain
+		c       mapChain
 	}{
 		{
 			[][]*Morph{
@@ -339,9 +429,9 @@ func TestChain_Add(t *testing.T) {
 					&Morph{"わ", "", "", "", "", "", "", "", "", ""},
 				},
 			},
-			chain{
-				Morph{"ぽ", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"わ", "", "", "", "", "", "", "", "", ""}: chain{},
+			mapChain{
+				Morph{"ぽ", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"わ", "", "", "", "", "", "", "", "", ""}: mapChain{},
 				},
 			},
 		},
@@ -356,12 +446,12 @@ func TestChain_Add(t *testing.T) {
 					&Morph{"う", "", "", "", "", "", "", "", "", ""},
 				},
 			},
-			chain{
-				Morph{"ぽ", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"わ", "", "", "", "", "", "", "", "", ""}: chain{},
+			mapChain{
+				Morph{"ぽ", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"わ", "", "", "", "", "", "", "", "", ""}: mapChain{},
 				},
-				Morph{"め", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{},
+				Morph{"め", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{},
 				},
 			},
 		},
@@ -380,26 +470,27 @@ func TestChain_Add(t *testing.T) {
 					&Morph{"う", "", "", "", "", "", "", "", "", ""},
 				},
 			},
-			chain{
-				Morph{"ぽ", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"わ", "", "", "", "", "", "", "", "", ""}: chain{},
-					Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{},
+			mapChain{
+				Morph{"ぽ", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"わ", "", "", "", "", "", "", "", "", ""}: mapChain{},
+					Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{},
 				},
-				Morph{"め", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{},
+				Morph{"め", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{},
 				},
 			},
 		},
 	}
 
 	for idx, test := range tests {
-		c := make(chain)
+		v := newVocabulary()
+		c := newChain()
 
 		for _, morphs := range test.morphss {
-			c.Add(morphs)
+			c.Add(v.internAll(morphs), 1)
 		}
-		if !reflect.DeepEqual(test.c, c) {
-			t.Errorf("[%d] expected\n%v, but got\n%v", idx, test.c, c)
+		if got := c.mapChain(v); !reflect.DeepEqual(test.c, got) {
+			t.Errorf("[%d] expected\n%v, but got\n%v", idx, test.c, got)
 		}
 	}
 }
@@ -407,15 +498,15 @@ func TestChain_Add(t *testing.T) {
 func TestChain_Choice(t *testing.T) {
 	tests := []struct {
 		morphs []*Morph
-		chain  chain
+		chain  mapChain
 		morph  *Morph
 		ok     bool
 	}{
 		{
 			[]*Morph{&Morph{"あ", "", "", "", "", "", "", "", "", ""}},
-			chain{
-				Morph{"あ", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{},
+			mapChain{
+				Morph{"あ", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{},
 				},
 			},
 			&Morph{"い", "", "", "", "", "", "", "", "", ""},
@@ -426,14 +517,14 @@ func TestChain_Choice(t *testing.T) {
 				&Morph{"あ", "", "", "", "", "", "", "", "", ""},
 				&Morph{"い", "", "", "", "", "", "", "", "", ""},
 			},
-			chain{
-				Morph{"あ", "", "", "", "", "", "", "", "", ""}: chain{
-					Morph{"い", "", "", "", "", "", "", "", "", ""}: chain{
-						Morph{"う", "", "", "", "", "", "", "", "", ""}: chain{},
+			mapChain{
+				Morph{"あ", "", "", "", "", "", "", "", "", ""}: mapChain{
+					Morph{"い", "", "", "", "", "", "", "", "", ""}: mapChain{
+						Morph{"う", "", "", "", "", "", "", "", "", ""}: mapChain{},
 					},
-					Morph{"え", "", "", "", "", "", "", "", "", ""}: chain{
-						Morph{"お", "", "", "", "", "", "", "", "", ""}: chain{},
-						Morph{"か", "", "", "", "", "", "", "", "", ""}: chain{},
+					Morph{"え", "", "", "", "", "", "", "", "", ""}: mapChain{
+						Morph{"お", "", "", "", "", "", "", "", "", ""}: mapChain{},
+						Morph{"か", "", "", "", "", "", "", "", "", ""}: mapChain{},
 					},
 				},
 			},
@@ -443,12 +534,675 @@ func TestChain_Choice(t *testing.T) {
 	}
 
 	for idx, test := range tests {
-		morph, ok := test.chain.RandomMorph(test.morphs)
+		v := newVocabulary()
+		c := test.chain.chain(v)
+		id, ok := c.RandomID(v.internAll(test.morphs))
 		if test.ok != ok {
 			t.Errorf("[%d] ok: expected %v, but got %v", idx, test.ok, ok)
 		}
-		if *test.morph != *morph {
+		if morph := v.morph(id); *test.morph != *morph {
 			t.Errorf("[%d] morph: expected %v, but got %v", idx, *test.morph, *morph)
 		}
 	}
 }
+
+func TestChain_RandomID_weight(t *testing.T) {
+	v := newVocabulary()
+	c := newChain()
+	heavy, light := v.intern(&Morph{Surface: "あ"}), v.intern(&Morph{Surface: "い"})
+	c.Add([]morphID{bosID, heavy}, 9)
+	c.Add([]morphID{bosID, light}, 1)
+
+	count := 0
+	for i := 0; i < 1000; i++ {
+		if id, _ := c.RandomID([]morphID{bosID}); id == heavy {
+			count++
+		}
+	}
+	if count < 800 || 980 < count {
+		t.Errorf("expected about 900 heavy morphs, but got %v", count)
+	}
+}
+
+func TestChain_Decay(t *testing.T) {
+	var (
+		a = Morph{Surface: "あ"}
+		i = Morph{Surface: "い"}
+		u = Morph{Surface: "う"}
+	)
+
+	tests := []struct {
+		morphss [][]*Morph
+		factor  float32
+		min     float32
+		c       mapChain
+		weight  float32 // weight of the first edge
+	}{
+		{
+			[][]*Morph{{&a, &i}, {&a, &i}, {&a, &u}},
+			0.5,
+			0.4,
+			mapChain{a: mapChain{i: mapChain{}, u: mapChain{}}},
+			1.5,
+		},
+		{
+			[][]*Morph{{&a, &i}, {&a, &i}, {&a, &u}},
+			0.5,
+			0.6,
+			mapChain{a: mapChain{i: mapChain{}}},
+			1.5,
+		},
+		{
+			[][]*Morph{{&a, &i}, {&i, &u}, {&i, &u}},
+			0.5,
+			0.6,
+			mapChain{i: mapChain{u: mapChain{}}},
+			1,
+		},
+		{
+			[][]*Morph{{&a, &i}, {&a, &u}},
+			0.5,
+			0.6,
+			mapChain{},
+			0,
+		},
+	}
+
+	for idx, test := range tests {
+		v := newVocabulary()
+		c := newChain()
+		for _, morphs := range test.morphss {
+			c.Add(v.internAll(morphs), 1)
+		}
+
+		before := c.mapChain(v)
+		decayed := c.Decay(test.factor, test.min)
+		if got := decayed.mapChain(v); !reflect.DeepEqual(test.c, got) {
+			t.Errorf("[%d] expected\n%v, but got\n%v", idx, test.c, got)
+		}
+		var weight float32
+		if edges := decayed.nodes[0].edges; len(edges) > 0 {
+			weight = edges[0].weight
+		}
+		if weight != test.weight {
+			t.Errorf("[%d] weight: expected %v, but got %v", idx, test.weight, weight)
+		}
+		if after := c.mapChain(v); !reflect.DeepEqual(before, after) {
+			t.Errorf("[%d] original chain is modified", idx)
+		}
+	}
+}
+
+func TestMarkov_add_decay(t *testing.T) {
+	a := append(append(Sentence{&BOS}, surfaces("あ", "い")...), &EOS)
+	b := append(append(Sentence{&BOS}, surfaces("う", "え")...), &EOS)
+	c := append(append(Sentence{&BOS}, surfaces("か", "き")...), &EOS)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewMarkov(&MarkovParams{
+		Ngram:          2,
+		ChainNum:       3,
+		ChainMorphsNum: 3, // each sentence has 3 ngrams
+		HalfLife:       time.Hour,
+		MinWeight:      0.3,
+	})
+	m.add(a, now)
+	m.add(a, now)
+	m.add(b, now)
+	select {
+	case <-m.Ready:
+	default:
+		t.Errorf("expected ready after 3 publications")
+	}
+
+	m.add(c, now.Add(2*time.Hour))
+	expected := mapChain{
+		BOS: mapChain{
+			Morph{Surface: "あ"}: mapChain{},
+			Morph{Surface: "か"}: mapChain{},
+		},
+		Morph{Surface: "あ"}: mapChain{Morph{Surface: "い"}: mapChain{}},
+		Morph{Surface: "い"}: mapChain{EOS: mapChain{}},
+		Morph{Surface: "か"}: mapChain{Morph{Surface: "き"}: mapChain{}},
+		Morph{Surface: "き"}: mapChain{EOS: mapChain{}},
+	}
+	chains := m.loadChains()
+	if len(chains) != 1 {
+		t.Fatalf("expected 1 chain, but got %v", len(chains))
+	}
+	if got := chains[0].mapChain(m.vocab); !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected\n%v, but got\n%v", expected, got)
+	}
+	if got := m.learning.mapChain(m.vocab); !reflect.DeepEqual(expected, got) {
+		t.Errorf("learning: expected\n%v, but got\n%v", expected, got)
+	}
+}
+
+func TestMarkov_add_decay_longPause(t *testing.T) {
+	a := Sentence{&BOS, &Morph{Surface: "あ"}, &EOS}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewMarkov(&MarkovParams{
+		Ngram:          2,
+		ChainNum:       1,
+		ChainMorphsNum: 1000,
+		HalfLife:       time.Minute,
+		MinWeight:      0.5,
+	})
+	m.add(a, now)
+	m.add(a, now.Add(200*time.Minute))
+
+	for _, node := range m.learning.nodes {
+		for _, edge := range node.edges {
+			if w := float64(edge.weight); math.IsInf(w, 0) || math.IsNaN(w) || w > 2 {
+				t.Errorf("expected weights about 1, but got %v", w)
+			}
+		}
+	}
+	if m.learning.Len() != 2 {
+		t.Errorf("expected 2 morphs, but got %v", m.learning.Len())
+	}
+}
+
+func TestMarkov_RandomMorph_uniform(t *testing.T) {
+	a, i := &Morph{Surface: "あ"}, &Morph{Surface: "い"}
+
+	tests := []struct {
+		params *MarkovParams
+		min    int // min count of あ in 1000 times
+		max    int
+	}{
+		{&MarkovParams{Ngram: 2, ChainNum: 1, ChainMorphsNum: 3}, 400, 600},
+		{&MarkovParams{Ngram: 2, ChainNum: 1, ChainMorphsNum: 3, HalfLife: time.Hour}, 800, 980},
+	}
+
+	for idx, test := range tests {
+		m := NewMarkov(test.params)
+		now := time.Now()
+		for j := 0; j < 9; j++ {
+			m.add(Sentence{&BOS, a, &EOS}, now)
+		}
+		m.add(Sentence{&BOS, i, &EOS}, now)
+		if test.params.HalfLife > 0 {
+			m.decay(now)
+		}
+
+		count := 0
+		for j := 0; j < 1000; j++ {
+			if morph, _ := m.RandomMorph([]*Morph{&BOS}); *morph == *a {
+				count++
+			}
+		}
+		if count < test.min || test.max < count {
+			t.Errorf("[%d] expected %v to %v, but got %v", idx, test.min, test.max, count)
+		}
+	}
+}
+
+func TestChain_BuildBackoff(t *testing.T) {
+	var (
+		a = Morph{Surface: "あ"}
+		i = Morph{Surface: "い"}
+		u = Morph{Surface: "う"}
+		e = Morph{Surface: "え"}
+		k = Morph{Surface: "か"}
+	)
+
+	v := newVocabulary()
+	c := newChain()
+	for _, morphs := range [][]*Morph{{&a, &i, &u}, {&k, &i, &u}, {&a, &i, &e}, {&a, &i, &u}} {
+		c.Add(v.internAll(morphs), 1)
+	}
+	c.BuildBackoff(3)
+
+	tests := []struct {
+		c       mapChain
+		weights []float32 // weights of edges which follow the first morph
+	}{
+		{
+			mapChain{u: mapChain{}, e: mapChain{}},
+			nil,
+		},
+		{
+			mapChain{i: mapChain{u: mapChain{}, e: mapChain{}}},
+			[]float32{2, 1}, // う follows あい and かい
+		},
+	}
+
+	if len(c.backoff) != len(tests) {
+		t.Fatalf("expected %v back-off chains, but got %v", len(tests), len(c.backoff))
+	}
+	for idx, test := range tests {
+		backoff := c.backoff[idx]
+		if got := backoff.mapChain(v); !reflect.DeepEqual(test.c, got) {
+			t.Errorf("[%d] expected\n%v, but got\n%v", idx, test.c, got)
+		}
+		var weights []float32
+		for _, edge := range backoff.edges([]morphID{v.intern(&i)}) {
+			weights = append(weights, edge.weight)
+		}
+		if !reflect.DeepEqual(test.weights, weights) {
+			t.Errorf("[%d] weights: expected %v, but got %v", idx, test.weights, weights)
+		}
+	}
+}
+
+func TestMarkov_RandomSentence_backoff(t *testing.T) {
+	var (
+		a = Morph{Surface: "あ"}
+		i = Morph{Surface: "い"}
+		u = Morph{Surface: "う"}
+		k = Morph{Surface: "か"}
+	)
+	c := mapChain{
+		BOS: mapChain{a: mapChain{i: mapChain{}}},
+		k:   mapChain{i: mapChain{u: mapChain{}}},
+		i:   mapChain{u: mapChain{EOS: mapChain{}}},
+	}
+
+	tests := []struct {
+		weights  []float64
+		sentence Sentence
+		ok       bool
+	}{
+		{nil, nil, false},
+		// あい is unknown as a context, so い is used instead.
+		{[]float64{1e-6}, Sentence{&a, &i, &u}, true},
+	}
+
+	for idx, test := range tests {
+		m := newTestMarkov(&MarkovParams{Ngram: 3, BackoffWeights: test.weights}, []mapChain{c})
+		sentence, ok := m.RandomSentence(10)
+		if ok != test.ok {
+			t.Errorf("[%d] ok: expected %v, but got %v", idx, test.ok, ok)
+		}
+		if !reflect.DeepEqual(test.sentence, sentence) {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.sentence, sentence)
+		}
+	}
+}
+
+func TestMarkov_LogProb(t *testing.T) {
+	var (
+		a = Morph{Surface: "あ"}
+		i = Morph{Surface: "い"}
+		k = Morph{Surface: "か"}
+	)
+	c := mapChain{
+		BOS: mapChain{a: mapChain{}, k: mapChain{}},
+		a:   mapChain{i: mapChain{}},
+		i:   mapChain{EOS: mapChain{}},
+	}
+
+	tests := []struct {
+		weights  []float64
+		sentence Sentence
+		logProb  float64
+		ok       bool
+	}{
+		{nil, Sentence{&a, &i}, math.Log(0.5), true},
+		{nil, Sentence{&BOS, &a, &i, &EOS}, math.Log(0.5), true},
+		{nil, Sentence{&k, &i}, 0, false},
+		{nil, Sentence{&a, &Morph{Surface: "ん"}}, 0, false},
+		{nil, Sentence{}, 0, false},
+		// か: (1 - 0.5) / 2 + 0.5 * 1/4 (unigram of か)
+		// い: no context か, so 1/4 (unigram of い)
+		{[]float64{0.5}, Sentence{&k, &i}, math.Log(0.375) + math.Log(0.25), true},
+	}
+
+	for idx, test := range tests {
+		m := newTestMarkov(&MarkovParams{Ngram: 2, BackoffWeights: test.weights}, []mapChain{c})
+		logProb, ok := m.LogProb(test.sentence)
+		if ok != test.ok {
+			t.Errorf("[%d] ok: expected %v, but got %v", idx, test.ok, ok)
+		}
+		if math.Abs(logProb-test.logProb) > 1e-9 {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.logProb, logProb)
+		}
+	}
+
+	m := newTestMarkov(&MarkovParams{Ngram: 2}, []mapChain{c})
+	if perplexity, _ := m.Perplexity(Sentence{&a, &i}); math.Abs(perplexity-math.Sqrt2) > 1e-9 {
+		t.Errorf("perplexity: expected %v, but got %v", math.Sqrt2, perplexity)
+	}
+	if fluency := m.Fluency(Sentence{&k, &i}); fluency != 0 {
+		t.Errorf("fluency: expected 0, but got %v", fluency)
+	}
+}
+
+func TestMarkov_prob_sum(t *testing.T) {
+	sentences := benchmarkSentences(100)
+	m := NewMarkov(&MarkovParams{
+		Ngram:          3,
+		ChainNum:       2,
+		ChainMorphsNum: 100,
+		BackoffWeights: []float64{0.75, 0.5},
+	})
+	for _, sentence := range sentences {
+		m.Add(sentence)
+	}
+	chains := m.loadChains()
+
+	// probabilities of all morphs following each context sum to 1
+	for idx, sentence := range sentences[:10] {
+		ids := m.vocab.internAll(sentence)
+		for _, context := range [][]morphID{ids[:1], ids[1:3]} {
+			var sum float64
+			for id := 0; id < m.vocab.Len(); id++ {
+				sum += m.prob(chains, context, morphID(id), len(context))
+			}
+			if math.Abs(sum-1) > 1e-6 {
+				t.Errorf("[%d] expected 1, but got %v for %v", idx, sum, context)
+			}
+		}
+	}
+}
+
+func TestMarkov_RandomMoraSentence(t *testing.T) {
+	var (
+		a = Morph{"あ", "", "", "", "", "", "", "", "", "アア"}
+		i = Morph{"い", "", "", "", "", "", "", "", "", "イイイ"}
+		u = Morph{"う", "", "", "", "", "", "", "", "", "ウ"}
+		w = Morph{"ｗ", "", "", "", "", "", "", "", "", ""}
+	)
+
+	tests := []struct {
+		moraLen  int
+		chain    mapChain
+		sentence Sentence
+		ok       bool
+	}{
+		{
+			4,
+			mapChain{
+				BOS: mapChain{a: mapChain{}},
+				a:   mapChain{i: mapChain{}},
+				i:   mapChain{u: mapChain{}},
+				u:   mapChain{EOS: mapChain{}},
+			},
+			Sentence{&a, &i},
+			true,
+		},
+		{
+			2,
+			mapChain{
+				BOS: mapChain{a: mapChain{}},
+				a:   mapChain{i: mapChain{}},
+			},
+			Sentence{&a},
+			true,
+		},
+		{
+			10,
+			mapChain{
+				BOS: mapChain{a: mapChain{}},
+				a:   mapChain{i: mapChain{}},
+				i:   mapChain{u: mapChain{}},
+				u:   mapChain{EOS: mapChain{}},
+			},
+			Sentence{&a, &i, &u},
+			true,
+		},
+		{
+			4,
+			mapChain{
+				BOS: mapChain{a: mapChain{}},
+				a:   mapChain{w: mapChain{}},
+				w:   mapChain{i: mapChain{}},
+			},
+			nil,
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+		m := newTestMarkov(&MarkovParams{Ngram: 2}, []mapChain{test.chain})
+		sentence, ok := m.RandomMoraSentence(test.moraLen)
+		if ok != test.ok {
+			t.Errorf("[%d] ok: expected %v, but got %v", idx, test.ok, ok)
+		}
+		if !reflect.DeepEqual(test.sentence, sentence) {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.sentence, sentence)
+		}
+	}
+}
+
+// TestMarkov_concurrent learns and generates at once. Run it with -race.
+func TestMarkov_concurrent(t *testing.T) {
+	sentences := benchmarkSentences(3000)
+	m := NewMarkov(&MarkovParams{
+		Ngram:          3,
+		ChainNum:       3,
+		ChainMorphsNum: 300,
+		BackoffWeights: []float64{0.75},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, sentence := range sentences {
+			m.Add(sentence)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-m.Ready
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				sentence, ok := m.RandomSentence(10)
+				if !ok {
+					continue
+				}
+				for _, morph := range sentence {
+					if !strings.HasPrefix(morph.Surface, "語") {
+						errs <- fmt.Errorf("unknown morph %v in %v", *morph, sentence)
+						return
+					}
+				}
+				m.RandomMoraSentence(10)
+				m.RandomMorph([]*Morph{&BOS})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if chains := m.loadChains(); len(chains) != 3 {
+		t.Errorf("expected 3 chains, but got %v", len(chains))
+	}
+}
+
+func TestMarkov_vocabulary(t *testing.T) {
+	tests := []struct {
+		params *MarkovParams
+	}{
+		{&MarkovParams{Ngram: 2, ChainNum: 2, ChainMorphsNum: 50}},
+		{&MarkovParams{Ngram: 2, ChainNum: 2, ChainMorphsNum: 50, BackoffWeights: []float64{0.5}}},
+		{&MarkovParams{Ngram: 2, ChainNum: 2, ChainMorphsNum: 50, HalfLife: time.Minute, MinWeight: 0.5}},
+	}
+
+	for idx, test := range tests {
+		m := NewMarkov(test.params)
+		now := time.Now()
+		// every sentence has new morphs, so old morphs are forgotten
+		for i := 0; i < 2000; i++ {
+			sentence := Sentence{&BOS}
+			for j := 0; j < 5; j++ {
+				surface := fmt.Sprintf("語%d-%d", i, j)
+				sentence = append(sentence, &Morph{surface, "名詞", "一般", "*", "*", "*", "*", surface, "ゴ", "ゴ"})
+			}
+			m.add(append(sentence, &EOS), now.Add(time.Duration(i)*time.Second))
+		}
+
+		// 2 chains of 50 ngrams have 500 morphs at most
+		if n := m.vocab.Len(); n > 2*500+2 {
+			t.Errorf("[%d] expected at most %v morphs, but got %v", idx, 2*500+2, n)
+		}
+		// the last sentence of a chain may be cut by rotation
+		var sentence Sentence
+		var ok bool
+		for try := 0; try < 100 && !ok; try++ {
+			sentence, ok = m.RandomSentence(10)
+		}
+		if !ok {
+			t.Errorf("[%d] expected a sentence, but got none", idx)
+		}
+		for _, morph := range sentence {
+			if !strings.HasPrefix(morph.Surface, "語") {
+				t.Errorf("[%d] unknown morph %v in %v", idx, *morph, sentence)
+			}
+		}
+	}
+}
+
+// benchmarkSentences returns n random sentences whose morphs follow Zipf's
+// law like real texts.
+func benchmarkSentences(n int) []Sentence {
+	r := rand.New(rand.NewSource(1))
+	vocab := make([]*Morph, 20000)
+	for i := range vocab {
+		vocab[i] = &Morph{
+			fmt.Sprintf("語%d", i), "名詞", "一般", "*", "*", "*", "*",
+			fmt.Sprintf("語%d", i), fmt.Sprintf("ゴ%d", i), fmt.Sprintf("ゴ%d", i),
+		}
+	}
+	zipf := rand.NewZipf(r, 1.1, 1, uint64(len(vocab)-1))
+
+	sentences := make([]Sentence, n)
+	for i := range sentences {
+		sentence := Sentence{&BOS}
+		for j := 5 + r.Intn(16); j > 0; j-- {
+			sentence = append(sentence, vocab[zipf.Uint64()])
+		}
+		sentences[i] = append(sentence, &EOS)
+	}
+	return sentences
+}
+
+// benchmarkNgram is n of ngrams in benchmarks.
+const benchmarkNgram = 3
+
+// eachNgram calls f with each ngram of sentence.
+func eachNgram(sentence Sentence, f func(morphs []*Morph)) {
+	for i := 0; i+benchmarkNgram <= len(sentence); i++ {
+		f(sentence[i : i+benchmarkNgram])
+	}
+}
+
+func BenchmarkChain_Add(b *testing.B) {
+	sentences := benchmarkSentences(10000)
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		c := mapChain{}
+		for i := 0; i < b.N; i++ {
+			eachNgram(sentences[i%len(sentences)], c.Add)
+		}
+	})
+	b.Run("compact", func(b *testing.B) {
+		b.ReportAllocs()
+		v := newVocabulary()
+		c := newChain()
+		for i := 0; i < b.N; i++ {
+			eachNgram(sentences[i%len(sentences)], func(morphs []*Morph) {
+				c.Add(v.internAll(morphs), 1)
+			})
+		}
+	})
+}
+
+func BenchmarkChain_RandomMorph(b *testing.B) {
+	sentences := benchmarkSentences(10000)
+	var contexts [][]*Morph
+	for _, sentence := range sentences {
+		eachNgram(sentence, func(morphs []*Morph) {
+			contexts = append(contexts, morphs[:benchmarkNgram-1])
+		})
+	}
+
+	b.Run("map", func(b *testing.B) {
+		c := mapChain{}
+		for _, sentence := range sentences {
+			eachNgram(sentence, c.Add)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, ok := c.RandomMorph(contexts[i%len(contexts)]); !ok {
+				b.Fatal("no morph")
+			}
+		}
+	})
+	b.Run("compact", func(b *testing.B) {
+		m := NewMarkov(&MarkovParams{Ngram: benchmarkNgram})
+		c := newChain()
+		for _, sentence := range sentences {
+			eachNgram(sentence, func(morphs []*Morph) {
+				c.Add(m.vocab.internAll(morphs), 1)
+			})
+		}
+		m.publish([]*chain{c})
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, ok := m.RandomMorph(contexts[i%len(contexts)]); !ok {
+				b.Fatal("no morph")
+			}
+		}
+	})
+}
+
+// BenchmarkChain_memory reports heap bytes which a chain of learned
+// sentences uses.
+func BenchmarkChain_memory(b *testing.B) {
+	sentences := benchmarkSentences(20000)
+	heap := func() uint64 {
+		var stats runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	b.Run("map", func(b *testing.B) {
+		var bytes uint64
+		for i := 0; i < b.N; i++ {
+			before := heap()
+			c := mapChain{}
+			for _, sentence := range sentences {
+				eachNgram(sentence, c.Add)
+			}
+			bytes += heap() - before
+			runtime.KeepAlive(c)
+		}
+		b.ReportMetric(float64(bytes)/float64(b.N), "heap-B/chain")
+	})
+	b.Run("compact", func(b *testing.B) {
+		var bytes uint64
+		for i := 0; i < b.N; i++ {
+			before := heap()
+			v := newVocabulary()
+			c := newChain()
+			for _, sentence := range sentences {
+				eachNgram(sentence, func(morphs []*Morph) {
+					c.Add(v.internAll(morphs), 1)
+				})
+			}
+			bytes += heap() - before
+			runtime.KeepAlive(v)
+			runtime.KeepAlive(c)
+		}
+		b.ReportMetric(float64(bytes)/float64(b.N), "heap-B/chain")
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Moderator rejects lyrics which contain NG words. Words are matched on
+// surface, reading and pronunciation after normalization, so hiragana,
+// katakana and full-width variants are caught.
+type Moderator struct {
+	words   []string // normalized NG words
+	logger  *log.Logger
+	logFile io.Closer // NG words log. nil means nothing to close.
+}
+
+// DefaultModerator uses .env values. NG words are read from files in
+// NG_WORDS_FILES, one word per line. Rejected lyrics are logged to
+// NG_WORDS_LOG or stderr.
+func DefaultModerator() (*Moderator, error) {
+	var words []string
+	for _, path := range envListDefault("NG_WORDS_FILES", nil) {
+		ws, err := readWordList(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create moderator: %w", err)
+		}
+		words = append(words, ws...)
+	}
+
+	w := io.Writer(os.Stderr)
+	var logFile *os.File
+	if path := os.Getenv("NG_WORDS_LOG"); path != "" {
+		var err error
+		logFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create moderator: %w", err)
+		}
+		w = logFile
+	}
+
+	mo := NewModerator(words, w)
+	if logFile != nil {
+		mo.logFile = logFile
+	}
+	return mo, nil
+}
+
+// Close closes the NG words log.
+func (mo *Moderator) Close() error {
+	if mo.logFile == nil {
+		return nil
+	}
+	return mo.logFile.Close()
+}
+
+// readWordList reads words from path. Empty lines and lines which begin
+// with "#" are ignored.
+func readWordList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+// NewModerator returns new Moderator. Rejected lyrics are logged to w.
+func NewModerator(words []string, w io.Writer) *Moderator {
+	normalized := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = normalizeText(word); word != "" {
+			normalized = append(normalized, word)
+		}
+	}
+	return &Moderator{
+		words:  normalized,
+		logger: log.New(w, "moderation: ", log.LstdFlags),
+	}
+}
+
+// Check returns the NG word which the lyric contains. If the lyric is clean,
+// ok will be true.
+func (mo *Moderator) Check(lyric Lyric) (word string, ok bool) {
+	for _, sentence := range lyric {
+		surface, reading, pronunciation := sentenceForms(sentence)
+		for _, word := range mo.words {
+			if strings.Contains(surface, word) ||
+				strings.Contains(reading, word) ||
+				strings.Contains(pronunciation, word) {
+				return word, false
+			}
+		}
+	}
+	return "", true
+}
+
+// Accept returns whether the lyric is clean. Rejected lyrics are logged.
+func (mo *Moderator) Accept(lyric Lyric) bool {
+	word, ok := mo.Check(lyric)
+	if !ok {
+		mo.logger.Printf("rejected by %q: %q", word, lyric.String())
+	}
+	return ok
+}
+
+// ModerateServer passes clean lyrics from chIn to chOut forever.
+func (mo *Moderator) ModerateServer(chOut chan<- Lyric, chIn <-chan Lyric) {
+	for lyric := range chIn {
+		if mo.Accept(lyric) {
+			chOut <- lyric
+		}
+	}
+}
+
+// sentenceForms returns normalized surface, reading and pronunciation of
+// the sentence. If a morph has no reading, its surface is used instead.
+func sentenceForms(sentence Sentence) (surface, reading, pronunciation string) {
+	var sb, rb, pb strings.Builder
+	for _, morph := range sentence {
+		sb.WriteString(morph.Surface)
+		rb.WriteString(morphForm(morph.Reading, morph.Surface))
+		pb.WriteString(morphForm(morph.Pronunciation, morph.Surface))
+	}
+	return normalizeText(sb.String()), normalizeText(rb.String()), normalizeText(pb.String())
+}
+
+// morphForm returns form, or surface if form is unknown.
+func morphForm(form, surface string) string {
+	if form == "" || form == "*" {
+		return surface
+	}
+	return form
+}
+
+// normalizeText converts hiragana into katakana, full-width ASCII into
+// half-width, upper case into lower case, and removes spaces.
+func normalizeText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case 'ぁ' <= r && r <= 'ゖ':
+			r += 'ァ' - 'ぁ'
+		case '！' <= r && r <= '～':
+			r -= '！' - '!'
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestModerator_Check(t *testing.T) {
+	mo := NewModerator([]string{"ばか", "ＮＧ", "  "}, new(bytes.Buffer))
+
+	tests := []struct {
+		lyric Lyric
+		word  string
+		ok    bool
+	}{
+		{
+			Lyric{
+				Sentence{&Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}},
+			},
+			"",
+			true,
+		},
+		{
+			Lyric{
+				Sentence{&Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}},
+				Sentence{&Morph{"馬鹿", "名詞", "形容動詞語幹", "*", "*", "*", "*", "馬鹿", "バカ", "バカ"}},
+			},
+			"バカ",
+			false,
+		},
+		{
+			Lyric{
+				Sentence{&Morph{"バカ", "名詞", "一般", "*", "*", "*", "*", "*", "", ""}},
+			},
+			"バカ",
+			false,
+		},
+		{
+			Lyric{
+				Sentence{
+					&Morph{"ng", "名詞", "一般", "*", "*", "*", "*", "*", "", ""},
+					&Morph{"だ", "助動詞", "*", "*", "*", "特殊・ダ", "基本形", "だ", "ダ", "ダ"},
+				},
+			},
+			"ng",
+			false,
+		},
+		{
+			Lyric{
+				Sentence{
+					&Morph{"ば", "助詞", "接続助詞", "*", "*", "*", "*", "ば", "バ", "バ"},
+					&Morph{"蚊", "名詞", "一般", "*", "*", "*", "*", "蚊", "カ", "カ"},
+				},
+			},
+			"バカ",
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+		word, ok := mo.Check(test.lyric)
+		if ok != test.ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+		if word != test.word {
+			t.Errorf("[%d] expected %q, but got %q", idx, test.word, word)
+		}
+	}
+}
+
+func TestModerator_Accept(t *testing.T) {
+	buf := new(bytes.Buffer)
+	mo := NewModerator([]string{"ばか"}, buf)
+
+	lyric := Lyric{Sentence{&Morph{"ばか", "名詞", "一般", "*", "*", "*", "*", "ばか", "バカ", "バカ"}}}
+	if mo.Accept(lyric) {
+		t.Errorf("expected rejected, but accepted")
+	}
+	if !strings.Contains(buf.String(), `rejected by "バカ"`) {
+		t.Errorf("expected rejection log, but got %q", buf.String())
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		text, normalized string
+	}{
+		{"ばか", "バカ"},
+		{"バカ", "バカ"},
+		{"ＡＢＣ abc", "abcabc"},
+		{"ゔぁ", "ヴァ"},
+	}
+
+	for idx, test := range tests {
+		if normalized := normalizeText(test.text); normalized != test.normalized {
+			t.Errorf("[%d] expected %q, but got %q", idx, test.normalized, normalized)
+		}
+	}
+}
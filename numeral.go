@@ -0,0 +1,413 @@
+package main
+
+import (
+	"strings"
+)
+
+// numeralDigits are values of digits. Kanji digits can be used positionally
+// (e.g. "二〇二〇") as well as Arabic digits.
+var numeralDigits = map[rune]uint64{
+	'0': 0, '1': 1, '2': 2, '3': 3, '4': 4, '5': 5, '6': 6, '7': 7, '8': 8, '9': 9,
+	'０': 0, '１': 1, '２': 2, '３': 3, '４': 4, '５': 5, '６': 6, '７': 7, '８': 8, '９': 9,
+	'〇': 0, '零': 0, '一': 1, '二': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+}
+
+// numeralSmallUnits are kanji units less than 万.
+var numeralSmallUnits = map[rune]uint64{'十': 10, '百': 100, '千': 1000}
+
+// numeralLargeUnits are kanji units which group four digits.
+var numeralLargeUnits = map[rune]uint64{'万': 1e4, '億': 1e8, '兆': 1e12}
+
+// digitReadings are readings of digits in numbers.
+var digitReadings = [10]string{"ゼロ", "イチ", "ニ", "サン", "ヨン", "ゴ", "ロク", "ナナ", "ハチ", "キュウ"}
+
+// maxNumeralDigits is the longest number which is read as a number.
+// Longer ones are read digit by digit.
+const maxNumeralDigits = 16
+
+// maxNumeral is the upper bound of numbers which numberReading reads.
+const maxNumeral uint64 = 1e16
+
+// readNumeral returns the pronunciation of a numeral such as "2020",
+// "10,000", "1.5" or "三百". Numbers which begin with 0 (e.g. "007") are read
+// digit by digit.
+func readNumeral(numeral string) (string, bool) {
+	numeral = strings.NewReplacer(",", "", "，", "").Replace(numeral)
+	integer, fraction := numeral, ""
+	if i := strings.IndexAny(numeral, ".．"); i >= 0 {
+		integer = numeral[:i]
+		fraction = strings.TrimLeft(numeral[i:], ".．")
+	}
+
+	reading, ok := readInteger(integer)
+	if !ok {
+		return "", false
+	}
+	if fraction == "" {
+		return reading, true
+	}
+
+	frac, ok := readDigits(fraction)
+	if !ok {
+		return "", false
+	}
+	if r, ok := geminate(reading, stGeminateEndings); ok {
+		reading = r
+	}
+	return reading + "テン" + frac, true
+}
+
+// readInteger returns the pronunciation of an integer numeral.
+func readInteger(numeral string) (string, bool) {
+	runes := []rune(numeral)
+	if len(runes) == 0 {
+		return "", false
+	}
+	if !strings.ContainsAny(numeral, "十百千万億兆") &&
+		(len(runes) > maxNumeralDigits || len(runes) > 1 && numeralDigits[runes[0]] == 0) {
+		return readDigits(numeral)
+	}
+
+	// Every sum is kept less than maxNumeral not to overflow.
+	var total, section, current, lastLarge uint64
+	var digits int
+	for _, r := range runes {
+		if d, ok := numeralDigits[r]; ok {
+			if digits++; digits > maxNumeralDigits {
+				return "", false
+			}
+			current = current*10 + d
+		} else if unit, ok := numeralSmallUnits[r]; ok {
+			if current == 0 {
+				current = 1
+			}
+			if current >= maxNumeral/unit {
+				return "", false
+			}
+			section += current * unit
+			current = 0
+		} else if unit, ok := numeralLargeUnits[r]; ok {
+			// large units must decrease (e.g. "千兆兆" is not a number)
+			if lastLarge != 0 && unit >= lastLarge {
+				return "", false
+			}
+			lastLarge = unit
+			section += current
+			if section == 0 {
+				section = 1
+			}
+			if section >= maxNumeral/unit {
+				return "", false
+			}
+			total += section * unit
+			section, current = 0, 0
+		} else {
+			return "", false
+		}
+		if total+section+current >= maxNumeral {
+			return "", false
+		}
+	}
+	return numberReading(total + section + current), true
+}
+
+// readDigits reads numeral digit by digit.
+func readDigits(numeral string) (string, bool) {
+	var b strings.Builder
+	for _, r := range numeral {
+		d, ok := numeralDigits[r]
+		if !ok {
+			return "", false
+		}
+		b.WriteString(digitReadings[d])
+	}
+	return b.String(), b.Len() > 0
+}
+
+// numberReading returns the pronunciation of n.
+func numberReading(n uint64) string {
+	if n == 0 {
+		return digitReadings[0]
+	}
+
+	units := []struct {
+		value   uint64
+		reading string
+	}{
+		{1e12, "チョウ"}, {1e8, "オク"}, {1e4, "マン"}, {1, ""},
+	}
+
+	var b strings.Builder
+	for _, unit := range units {
+		group := n / unit.value % 10000
+		if group == 0 {
+			continue
+		}
+		reading := groupReading(group, unit.value > 1)
+		if unit.value == 1e12 {
+			if r, ok := geminate(reading, stGeminateEndings); ok {
+				reading = r
+			}
+		}
+		b.WriteString(reading + unit.reading)
+	}
+	return b.String()
+}
+
+// groupReading returns the pronunciation of n less than 10000. If large is
+// true, n is followed by a large unit such as 万.
+func groupReading(n uint64, large bool) string {
+	var b strings.Builder
+
+	switch d := n / 1000; d {
+	case 0:
+	case 1:
+		if large {
+			b.WriteString("イッ")
+		}
+		b.WriteString("セン")
+	case 3:
+		b.WriteString("サンゼン")
+	case 8:
+		b.WriteString("ハッセン")
+	default:
+		b.WriteString(digitReadings[d] + "セン")
+	}
+
+	switch d := n / 100 % 10; d {
+	case 0:
+	case 1:
+		b.WriteString("ヒャク")
+	case 3:
+		b.WriteString("サンビャク")
+	case 6:
+		b.WriteString("ロッピャク")
+	case 8:
+		b.WriteString("ハッピャク")
+	default:
+		b.WriteString(digitReadings[d] + "ヒャク")
+	}
+
+	switch d := n / 10 % 10; d {
+	case 0:
+	case 1:
+		b.WriteString("ジュウ")
+	default:
+		b.WriteString(digitReadings[d] + "ジュウ")
+	}
+
+	if d := n % 10; d > 0 {
+		b.WriteString(digitReadings[d])
+	}
+	return b.String()
+}
+
+var (
+	// khGeminateEndings are endings of numbers which become ッ before
+	// counters beginning with k, h or p (e.g. いっぽん, ろっこ, ひゃっかい).
+	khGeminateEndings = []string{"イチ", "ロク", "ハチ", "ジュウ", "ャク"}
+
+	// stGeminateEndings are endings of numbers which become ッ before
+	// counters beginning with s or t (e.g. いっさい, はっちょう).
+	stGeminateEndings = []string{"イチ", "ハチ", "ジュウ"}
+)
+
+// geminate replaces the last kana of reading with ッ if reading has one of
+// endings.
+func geminate(reading string, endings []string) (string, bool) {
+	for _, ending := range endings {
+		if strings.HasSuffix(reading, ending) {
+			runes := []rune(reading)
+			return string(runes[:len(runes)-1]) + "ッ", true
+		}
+	}
+	return reading, false
+}
+
+// counterReading describes sound changes between a number and a counter.
+type counterReading struct {
+	geminateEndings []string             // number endings which become ッ
+	geminated       string               // counter reading after ッ
+	afterN          string               // counter reading after nEndings
+	reading         string               // counter reading which replaces the dictionary one
+	endings         map[string]string    // number endings which change
+	irregulars      map[string][2]string // whole readings of number and counter
+}
+
+var (
+	// nEndings are endings of numbers which voice the following counter
+	// (e.g. さんぼん, せんげん). ヨン is not one of them (e.g. よんほん).
+	nEndings = []string{"サン", "セン", "ゼン", "マン"}
+
+	// hourEndings are used for 時 (e.g. よじ, しちじ, くじ).
+	hourEndings = map[string]string{"ヨン": "ヨ", "ナナ": "シチ", "キュウ": "ク"}
+
+	// monthEndings are used for 月 (e.g. しがつ, しちがつ, くがつ).
+	monthEndings = map[string]string{"ヨン": "シ", "ナナ": "シチ", "キュウ": "ク"}
+
+	// yonEndings are used for counters which follow よ instead of よん.
+	yonEndings = map[string]string{"ヨン": "ヨ"}
+)
+
+// counterReadings are sound changes of counters.
+var counterReadings = map[string]counterReading{
+	"本": {geminateEndings: khGeminateEndings, geminated: "ポン", afterN: "ボン"},
+	"杯": {geminateEndings: khGeminateEndings, geminated: "パイ", afterN: "バイ"},
+	"匹": {geminateEndings: khGeminateEndings, geminated: "ピキ", afterN: "ビキ"},
+	"発": {geminateEndings: khGeminateEndings, geminated: "パツ", afterN: "パツ"},
+	"分": {geminateEndings: khGeminateEndings, geminated: "プン", afterN: "プン"},
+	"泊": {geminateEndings: khGeminateEndings, geminated: "パク", afterN: "パク"},
+	"個": {geminateEndings: khGeminateEndings, geminated: "コ"},
+	"回": {geminateEndings: khGeminateEndings, geminated: "カイ"},
+	"階": {geminateEndings: khGeminateEndings, geminated: "カイ", afterN: "ガイ"},
+	"軒": {geminateEndings: khGeminateEndings, geminated: "ケン", afterN: "ゲン"},
+	"件": {geminateEndings: khGeminateEndings, geminated: "ケン"},
+	"曲": {geminateEndings: khGeminateEndings, geminated: "キョク"},
+	"歳": {geminateEndings: stGeminateEndings, geminated: "サイ"},
+	"才": {geminateEndings: stGeminateEndings, geminated: "サイ"},
+	"冊": {geminateEndings: stGeminateEndings, geminated: "サツ"},
+	"足": {geminateEndings: stGeminateEndings, geminated: "ソク", afterN: "ゾク"},
+	"着": {geminateEndings: stGeminateEndings, geminated: "チャク"},
+	"点": {geminateEndings: stGeminateEndings, geminated: "テン"},
+	"通": {geminateEndings: stGeminateEndings, geminated: "ツウ"},
+	"%": {geminateEndings: []string{"イチ", "ハチ", "ジュウ", "ャク"}, geminated: "パーセント"},
+	"％": {geminateEndings: []string{"イチ", "ハチ", "ジュウ", "ャク"}, geminated: "パーセント"},
+	"時": {endings: hourEndings},
+	"月": {endings: monthEndings, reading: "ガツ"},
+	"年": {endings: yonEndings},
+	"円": {endings: yonEndings},
+	"人": {endings: yonEndings, irregulars: map[string][2]string{"イチ": {"ヒト", "リ"}, "ニ": {"フタ", "リ"}}},
+}
+
+// read returns the pronunciations of a number and the counter after sound
+// changes.
+func (cr counterReading) read(number, counter string) (string, string) {
+	if r, ok := cr.irregulars[number]; ok {
+		return r[0], r[1]
+	}
+	if cr.reading != "" {
+		counter = cr.reading
+	}
+	for from, to := range cr.endings {
+		if strings.HasSuffix(number, from) {
+			return strings.TrimSuffix(number, from) + to, counter
+		}
+	}
+	if r, ok := geminate(number, cr.geminateEndings); ok && cr.geminated != "" {
+		return r, cr.geminated
+	}
+	if cr.afterN != "" {
+		for _, ending := range nEndings {
+			if strings.HasSuffix(number, ending) {
+				return number, cr.afterN
+			}
+		}
+	}
+	return number, counter
+}
+
+// currencyReadings are currency symbols which are put before numbers and
+// read after them (e.g. "¥500" is ごひゃくえん).
+var currencyReadings = map[string]string{
+	"¥": "エン", "￥": "エン", "$": "ドル", "＄": "ドル", "€": "ユーロ",
+}
+
+// symbolReadings are readings of common symbols.
+var symbolReadings = map[string]string{
+	"%": "パーセント", "％": "パーセント",
+	"&": "アンド", "＆": "アンド",
+	"@": "アット", "＠": "アット",
+	"#": "ハッシュ", "＃": "ハッシュ",
+	"+": "プラス", "＋": "プラス",
+	"=": "イコール", "＝": "イコール",
+	"×": "カケル", "÷": "ワル",
+	"~": "カラ", "〜": "カラ", "～": "カラ",
+	"¥": "エン", "￥": "エン", "$": "ドル", "＄": "ドル", "€": "ユーロ",
+	"℃": "ド",
+}
+
+// isNumberMorph returns whether m is a numeral. "数" is of the IPA
+// dictionary and "数詞" is of UniDic.
+func isNumberMorph(m *Morph) bool {
+	return m.PartOfSpeech == "名詞" && (m.PartOfSpeechSection1 == "数" || m.PartOfSpeechSection1 == "数詞")
+}
+
+// numeralPronunciation reads numerals.
+func numeralPronunciation(m *Morph) (string, bool) {
+	if !isNumberMorph(m) {
+		return "", false
+	}
+	return readNumeral(m.Surface)
+}
+
+// symbolPronunciation reads common symbols.
+func symbolPronunciation(m *Morph) (string, bool) {
+	p, ok := symbolReadings[m.Surface]
+	return p, ok
+}
+
+// joinNumerals joins numerals which the tokenizer splits (e.g. "三" "百",
+// "10" "," "000") into one morph and reads it as a whole. A currency symbol
+// before the numeral is also joined. Then sound changes of counters after
+// numerals are applied.
+func joinNumerals(sentence Sentence) Sentence {
+	joined := make(Sentence, 0, len(sentence))
+	for i := 0; i < len(sentence); i++ {
+		currency, hasCurrency := currencyReadings[sentence[i].Surface]
+		start := i
+		if hasCurrency && i+1 < len(sentence) && isNumberMorph(sentence[i+1]) {
+			i++
+		} else if !isNumberMorph(sentence[i]) {
+			joined = append(joined, sentence[i])
+			continue
+		} else {
+			hasCurrency = false
+		}
+
+		end := i + 1
+		for end < len(sentence) {
+			if isNumberMorph(sentence[end]) {
+				end++
+			} else if strings.ContainsAny(sentence[end].Surface, ",.，．") &&
+				len([]rune(sentence[end].Surface)) == 1 &&
+				end+1 < len(sentence) && isNumberMorph(sentence[end+1]) {
+				end += 2
+			} else {
+				break
+			}
+		}
+
+		morph := *sentence[i]
+		var surface strings.Builder
+		for _, m := range sentence[i:end] {
+			surface.WriteString(m.Surface)
+		}
+		morph.Surface = surface.String()
+		if p, ok := readNumeral(morph.Surface); ok {
+			morph.Reading = p
+			morph.Pronunciation = p
+		} else if end-i > 1 {
+			morph.Reading = "*"
+			morph.Pronunciation = ""
+		}
+		if hasCurrency {
+			morph.Surface = sentence[start].Surface + morph.Surface
+			if morph.Pronunciation != "" {
+				morph.Pronunciation += currency
+				morph.Reading = morph.Pronunciation
+			}
+		}
+		joined = append(joined, &morph)
+		i = end - 1
+	}
+
+	for i := 1; i < len(joined); i++ {
+		number, counter := joined[i-1], joined[i]
+		cr, ok := counterReadings[counter.Surface]
+		if !ok || !isNumberMorph(number) || number.Pronunciation == "" || counter.Pronunciation == "" {
+			continue
+		}
+		number.Pronunciation, counter.Pronunciation = cr.read(number.Pronunciation, counter.Pronunciation)
+	}
+	return joined
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ikawaha/kagome/tokenizer"
+)
+
+func TestReadNumeral(t *testing.T) {
+	tests := []struct {
+		numeral       string
+		pronunciation string
+		ok            bool
+	}{
+		{"0", "ゼロ", true},
+		{"4", "ヨン", true},
+		{"2020", "ニセンニジュウ", true},
+		{"300", "サンビャク", true},
+		{"600", "ロッピャク", true},
+		{"8000", "ハッセン", true},
+		{"10,000", "イチマン", true},
+		{"１２３", "ヒャクニジュウサン", true},
+		{"10000000", "イッセンマン", true},
+		{"1000000000000", "イッチョウ", true},
+		{"1.5", "イッテンゴ", true},
+		{"007", "ゼロゼロナナ", true},
+		{"三百", "サンビャク", true},
+		{"二千二十", "ニセンニジュウ", true},
+		{"二〇二〇", "ニセンニジュウ", true},
+		{"十", "ジュウ", true},
+		{"一万", "イチマン", true},
+		{"2万5000", "ニマンゴセン", true},
+		{"九千九百九十九兆", "キュウセンキュウヒャクキュウジュウキュウチョウ", true},
+		{"千兆兆", "", false},
+		{"一万兆", "", false},
+		{"10000兆", "", false},
+		{"何", "", false},
+		{"", "", false},
+	}
+
+	for idx, test := range tests {
+		pronunciation, ok := readNumeral(test.numeral)
+		if test.ok != ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+		if test.pronunciation != pronunciation {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.pronunciation, pronunciation)
+		}
+	}
+}
+
+func TestAnalyzeText_numeral(t *testing.T) {
+	tests := []struct {
+		text          string
+		pronunciation string
+		ok            bool
+	}{
+		{"2020年", "ニセンニジュウネン", true},
+		{"100%", "ヒャッパーセント", true},
+		{"3時", "サンジ", true},
+		{"4時", "ヨジ", true},
+		{"三百人", "サンビャクニン", true},
+		{"1人", "ヒトリ", true},
+		{"1本", "イッポン", true},
+		{"3本", "サンボン", true},
+		{"4本", "ヨンホン", true},
+		{"4杯", "ヨンハイ", true},
+		{"4匹", "ヨンヒキ", true},
+		{"4軒", "ヨンケン", true},
+		{"4足", "ヨンソク", true},
+		{"3足", "サンゾク", true},
+		{"1000本", "センボン", true},
+		{"4月", "シガツ", true},
+		{"7月", "シチガツ", true},
+		{"9月", "クガツ", true},
+		{"12月", "ジュウニガツ", true},
+		{"六杯", "ロッパイ", true},
+		{"10個", "ジュッコ", true},
+		{"10,000円", "イチマンエン", true},
+		{"¥500", "ゴヒャクエン", true},
+		{"1.5倍", "イッテンゴバイ", true},
+		{"#tag & @you", "ハッシュタッグアンドアットユー", true},
+	}
+
+	tk := tokenizer.New()
+
+	for idx, test := range tests {
+		sentence := trimBOSEOS(analyzeText(&tk, test.text))
+		kana, ok := sentence.MoraKana()
+		if test.ok != ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+		if pronunciation := strings.Join(kana, ""); test.pronunciation != pronunciation {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.pronunciation, pronunciation)
+		}
+		if test.text != sentence.String() {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.text, sentence.String())
+		}
+	}
+}
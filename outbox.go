@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// Post is a status which will be posted.
+type Post struct {
+	Text   string
+	Params *twitter.StatusUpdateParams
+	Lyric  Lyric   // will be re-queued when posting failed. It may be nil.
+	Score  float64 // rhyme score of Lyric
+}
+
+// updateFunc posts a status.
+type updateFunc func(post *Post) (*http.Response, error)
+
+// Outbox posts statuses in the order they are sent. Transient errors are
+// retried with exponential backoff. Retries are scheduled with timers, so a
+// failing post does not block later posts, and it is posted after them.
+type Outbox struct {
+	update     updateFunc
+	schedule   func(wait time.Duration, p *pendingPost) // retries p after wait
+	requeue    func(Lyric)                              // called when retries are exhausted or the queue is full.
+	maxRetry   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	ch         chan *Post
+	retries    chan *pendingPost
+	logFile    io.Closer // dry run log. nil means nothing to close.
+}
+
+// pendingPost is a post to be retried.
+type pendingPost struct {
+	post *Post
+	try  int // number of failed tries
+}
+
+// DefaultOutbox uses .env values.
+func DefaultOutbox(client *twitter.Client, storage *LyricStorage) (*Outbox, error) {
+	maxRetry, err := envIntDefault("POST_MAX_RETRY", 5)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create outbox: %w", err)
+	}
+	backoff, err := envIntDefault("POST_BACKOFF_SECONDS", 2)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create outbox: %w", err)
+	}
+	maxBackoff, err := envIntDefault("POST_MAX_BACKOFF_SECONDS", 900)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create outbox: %w", err)
+	}
+	queueSize, err := envIntDefault("POST_QUEUE_SIZE", 100)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create outbox: %w", err)
+	}
+
+	dryRun, err := envBoolDefault("DRY_RUN", false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create outbox: %w", err)
+	}
+
+	update := func(post *Post) (*http.Response, error) {
+		_, resp, err := client.Statuses.Update(post.Text, post.Params)
+		return resp, err
+	}
+	var logFile *os.File
+	if dryRun {
+		w := io.Writer(os.Stdout)
+		if path := os.Getenv("DRY_RUN_LOG"); path != "" {
+			logFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, fmt.Errorf("cannot create outbox: %w", err)
+			}
+			w = logFile
+		}
+		update = dryRunUpdate(w)
+	}
+
+	ob := NewOutbox(update, storage.Push, maxRetry,
+		time.Duration(backoff)*time.Second, time.Duration(maxBackoff)*time.Second, queueSize)
+	if logFile != nil {
+		ob.logFile = logFile
+	}
+	return ob, nil
+}
+
+// Close closes the dry run log.
+func (ob *Outbox) Close() error {
+	if ob.logFile == nil {
+		return nil
+	}
+	return ob.logFile.Close()
+}
+
+// NewOutbox returns new Outbox which queues up to queueSize posts.
+func NewOutbox(update updateFunc, requeue func(Lyric), maxRetry int, backoff, maxBackoff time.Duration, queueSize int) *Outbox {
+	ob := &Outbox{
+		update:     update,
+		requeue:    requeue,
+		maxRetry:   maxRetry,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		ch:         make(chan *Post, queueSize),
+		retries:    make(chan *pendingPost),
+	}
+	ob.schedule = func(wait time.Duration, p *pendingPost) {
+		time.AfterFunc(wait, func() { ob.retries <- p })
+	}
+	return ob
+}
+
+// Send adds post to the outbox. If the outbox is full, post is dropped and
+// its lyric is requeued.
+func (ob *Outbox) Send(post *Post) {
+	select {
+	case ob.ch <- post:
+	default:
+		log.Printf("outbox is full: drop %q", post.Text)
+		if post.Lyric != nil && ob.requeue != nil {
+			ob.requeue(post.Lyric)
+		}
+	}
+}
+
+// PostServer posts statuses and retries forever.
+func (ob *Outbox) PostServer() {
+	for {
+		var p *pendingPost
+		select {
+		case post := <-ob.ch:
+			p = &pendingPost{post: post}
+		case p = <-ob.retries:
+		}
+		if err := ob.attempt(p); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// attempt posts p once. If the error is transient, a retry is scheduled.
+// If the error is permanent or retries are exhausted, returns the error.
+func (ob *Outbox) attempt(p *pendingPost) error {
+	resp, err := ob.update(p.post)
+	if err == nil && resp != nil && resp.StatusCode >= 400 {
+		err = errors.New(resp.Status)
+	}
+	if err == nil {
+		return nil
+	}
+
+	transient, wait := classifyPostError(resp, err)
+	if !transient {
+		return fmt.Errorf("post failed permanently: %w: %q", err, p.post.Text)
+	}
+	if p.try >= ob.maxRetry {
+		if p.post.Lyric != nil && ob.requeue != nil {
+			ob.requeue(p.post.Lyric)
+		}
+		return fmt.Errorf("post failed after %d tries: %w", p.try+1, err)
+	}
+
+	if wait <= 0 {
+		wait = ob.backoffDuration(p.try)
+	}
+	if ob.maxBackoff > 0 && wait > ob.maxBackoff {
+		wait = ob.maxBackoff
+	}
+	log.Printf("post failed (retry in %v): %v", wait, err)
+	ob.schedule(wait, &pendingPost{post: p.post, try: p.try + 1})
+	return nil
+}
+
+// backoffDuration returns the backoff after try failures. It is doubled for
+// each failure without overflow.
+func (ob *Outbox) backoffDuration(try int) time.Duration {
+	wait := ob.backoff
+	for i := 0; i < try; i++ {
+		if wait > math.MaxInt64/2 || ob.maxBackoff > 0 && wait >= ob.maxBackoff {
+			break
+		}
+		wait *= 2
+	}
+	return wait
+}
+
+// dryRunPost is a record of a post in dry-run mode.
+type dryRunPost struct {
+	Time              time.Time `json:"time"`
+	InReplyToStatusID int64     `json:"in_reply_to_status_id,omitempty"`
+	Text              string    `json:"text"`
+	Score             float64   `json:"score"`
+}
+
+// dryRunUpdate returns updateFunc which writes posts to w as JSON lines
+// instead of posting them.
+func dryRunUpdate(w io.Writer) updateFunc {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	return func(post *Post) (*http.Response, error) {
+		record := dryRunPost{
+			Time:  time.Now(),
+			Text:  post.Text,
+			Score: post.Score,
+		}
+		if post.Params != nil {
+			record.InReplyToStatusID = post.Params.InReplyToStatusID
+		}
+		if err := enc.Encode(record); err != nil {
+			return nil, fmt.Errorf("dry run: %w", err)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{}}, nil
+	}
+}
+
+// classifyPostError returns whether the error is transient. If the API
+// tells when the rate limit is reset, wait will be the duration until then.
+func classifyPostError(resp *http.Response, err error) (transient bool, wait time.Duration) {
+	var apiErr twitter.APIError
+	if errors.As(err, &apiErr) {
+		for _, detail := range apiErr.Errors {
+			switch detail.Code {
+			case 88, 185: // rate limit exceeded, over daily status update limit
+				return true, rateLimitReset(resp)
+			case 130, 131: // over capacity, internal error
+				return true, 0
+			}
+		}
+	}
+
+	if resp == nil {
+		// network error
+		return true, 0
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true, rateLimitReset(resp)
+	case resp.StatusCode >= 500:
+		return true, 0
+	}
+	return false, 0
+}
+
+// rateLimitReset returns the duration until the rate limit is reset.
+func rateLimitReset(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Until(time.Unix(reset, 0))
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+func TestOutbox_attempt(t *testing.T) {
+	transient := twitter.APIError{Errors: []twitter.ErrorDetail{{Message: "Internal error", Code: 131}}}
+	permanent := twitter.APIError{Errors: []twitter.ErrorDetail{{Message: "Status is a duplicate.", Code: 187}}}
+
+	tests := []struct {
+		errs     []error
+		maxRetry int
+		tries    int
+		sleeps   []time.Duration
+		requeued bool
+		ok       bool
+	}{
+		{
+			[]error{nil},
+			3,
+			1,
+			nil,
+			false,
+			true,
+		},
+		{
+			[]error{transient, transient, nil},
+			3,
+			3,
+			[]time.Duration{time.Second, 2 * time.Second},
+			false,
+			true,
+		},
+		{
+			[]error{transient, transient, transient},
+			2,
+			3,
+			[]time.Duration{time.Second, 2 * time.Second},
+			true,
+			false,
+		},
+		{
+			[]error{permanent},
+			3,
+			1,
+			nil,
+			false,
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+		var tries int
+		update := func(post *Post) (*http.Response, error) {
+			err := test.errs[tries]
+			tries++
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, err
+		}
+		var requeued bool
+		ob := NewOutbox(update, func(Lyric) { requeued = true }, test.maxRetry, time.Second, time.Minute, 1)
+		var sleeps []time.Duration
+		var retries []*pendingPost
+		ob.schedule = func(d time.Duration, p *pendingPost) {
+			sleeps = append(sleeps, d)
+			retries = append(retries, p)
+		}
+
+		err := ob.attempt(&pendingPost{post: &Post{Text: "test", Lyric: Lyric{}}})
+		for len(retries) > 0 && err == nil {
+			p := retries[0]
+			retries = retries[1:]
+			err = ob.attempt(p)
+		}
+		if (err == nil) != test.ok {
+			t.Errorf("[%d] ok: expected %v, but got %v", idx, test.ok, err)
+		}
+		if tries != test.tries {
+			t.Errorf("[%d] tries: expected %v, but got %v", idx, test.tries, tries)
+		}
+		if len(sleeps) != len(test.sleeps) {
+			t.Errorf("[%d] sleeps: expected %v, but got %v", idx, test.sleeps, sleeps)
+		} else {
+			for i := range sleeps {
+				if sleeps[i] != test.sleeps[i] {
+					t.Errorf("[%d] sleeps: expected %v, but got %v", idx, test.sleeps, sleeps)
+				}
+			}
+		}
+		if requeued != test.requeued {
+			t.Errorf("[%d] requeued: expected %v, but got %v", idx, test.requeued, requeued)
+		}
+	}
+}
+
+func TestOutbox_backoffDuration(t *testing.T) {
+	tests := []struct {
+		maxBackoff time.Duration
+		try        int
+		expected   time.Duration
+	}{
+		{time.Minute, 0, time.Second},
+		{time.Minute, 3, 8 * time.Second},
+		{time.Minute, 10, 64 * time.Second},
+		{0, 100, time.Second << 33},
+	}
+
+	for idx, test := range tests {
+		ob := NewOutbox(nil, nil, 0, time.Second, test.maxBackoff, 1)
+		actual := ob.backoffDuration(test.try)
+		if actual != test.expected {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.expected, actual)
+		}
+	}
+}
+
+func TestOutbox_Send(t *testing.T) {
+	var requeued int
+	ob := NewOutbox(nil, func(Lyric) { requeued++ }, 0, time.Second, time.Minute, 1)
+	ob.Send(&Post{Text: "first", Lyric: Lyric{}})
+	ob.Send(&Post{Text: "second", Lyric: Lyric{}})
+
+	if len(ob.ch) != 1 {
+		t.Errorf("expected %v, but got %v", 1, len(ob.ch))
+	}
+	if requeued != 1 {
+		t.Errorf("expected %v, but got %v", 1, requeued)
+	}
+}
+
+func TestClassifyPostError(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		resp      *http.Response
+		err       error
+		transient bool
+		waitMin   time.Duration
+	}{
+		{
+			nil,
+			errors.New("connection reset"),
+			true,
+			0,
+		},
+		{
+			&http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"X-Rate-Limit-Reset": {strconv.FormatInt(reset, 10)}},
+			},
+			twitter.APIError{Errors: []twitter.ErrorDetail{{Message: "Rate limit exceeded", Code: 88}}},
+			true,
+			50 * time.Minute,
+		},
+		{
+			&http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}},
+			errors.New("503 Service Unavailable"),
+			true,
+			0,
+		},
+		{
+			&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{}},
+			twitter.APIError{Errors: []twitter.ErrorDetail{{Message: "Status is a duplicate.", Code: 187}}},
+			false,
+			0,
+		},
+	}
+
+	for idx, test := range tests {
+		transient, wait := classifyPostError(test.resp, test.err)
+		if transient != test.transient {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.transient, transient)
+		}
+		if wait < test.waitMin {
+			t.Errorf("[%d] expected wait >= %v, but got %v", idx, test.waitMin, wait)
+		}
+	}
+}
+
+func TestDryRunUpdate(t *testing.T) {
+	tests := []struct {
+		post *Post
+		line string
+	}{
+		{
+			&Post{Text: "あ\nい", Score: 0.5},
+			`"text":"あ\nい","score":0.5}`,
+		},
+		{
+			&Post{
+				Text:   "@alice\nう",
+				Params: &twitter.StatusUpdateParams{InReplyToStatusID: 42},
+				Score:  0.25,
+			},
+			`"in_reply_to_status_id":42,"text":"@alice\nう","score":0.25}`,
+		},
+	}
+
+	for idx, test := range tests {
+		buf := new(bytes.Buffer)
+		resp, err := dryRunUpdate(buf)(test.post)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("[%d] unexpected result: %v, %v", idx, resp, err)
+		}
+		if !strings.Contains(buf.String(), test.line) {
+			t.Errorf("[%d] expected %v in %v", idx, test.line, buf.String())
+		}
+	}
+}
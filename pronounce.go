@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+)
+
+// pronunciationFallbacks guess the pronunciation of a morph which the
+// dictionary cannot pronounce. They are tried in order.
+var pronunciationFallbacks = []func(m *Morph) (string, bool){
+	readingPronunciation,
+	kanaPronunciation,
+	numeralPronunciation,
+	symbolPronunciation,
+	englishPronunciation,
+	asciiPronunciation,
+}
+
+// guessPronunciation returns a pronunciation of the morph which NewMorae can
+// parse. If the morph has one already, it is returned as it is.
+func guessPronunciation(m *Morph) (pronunciation string, ok bool) {
+	if isPronunciation(m.Pronunciation) {
+		return m.Pronunciation, true
+	}
+	for _, fallback := range pronunciationFallbacks {
+		if p, ok := fallback(m); ok && isPronunciation(p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// isPronunciation returns whether NewMorae can parse p.
+func isPronunciation(p string) bool {
+	_, ok := SplitMorae(p)
+	return ok
+}
+
+// readingPronunciation uses the reading of the dictionary.
+func readingPronunciation(m *Morph) (string, bool) {
+	return toKatakana(m.Reading), m.Reading != "" && m.Reading != "*"
+}
+
+// kanaPronunciation reads hiragana or katakana surfaces as they are.
+func kanaPronunciation(m *Morph) (string, bool) {
+	return toKatakana(m.Surface), m.Surface != ""
+}
+
+// asciiLetterReadings are readings of alphabets and digits.
+var asciiLetterReadings = map[rune]string{
+	'a': "エー", 'b': "ビー", 'c': "シー", 'd': "ディー", 'e': "イー",
+	'f': "エフ", 'g': "ジー", 'h': "エイチ", 'i': "アイ", 'j': "ジェー",
+	'k': "ケー", 'l': "エル", 'm': "エム", 'n': "エヌ", 'o': "オー",
+	'p': "ピー", 'q': "キュー", 'r': "アール", 's': "エス", 't': "ティー",
+	'u': "ユー", 'v': "ブイ", 'w': "ダブリュー", 'x': "エックス", 'y': "ワイ",
+	'z': "ゼット",
+	'0': "ゼロ", '1': "イチ", '2': "ニ", '3': "サン", '4': "ヨン",
+	'5': "ゴ", '6': "ロク", '7': "ナナ", '8': "ハチ", '9': "キュウ",
+}
+
+// asciiPronunciation spells out alphabets and digits one by one.
+// Full-width ones are also accepted.
+func asciiPronunciation(m *Morph) (string, bool) {
+	var b strings.Builder
+	for _, r := range normalizeText(m.Surface) {
+		reading, ok := asciiLetterReadings[r]
+		if !ok {
+			return "", false
+		}
+		b.WriteString(reading)
+	}
+	return b.String(), b.Len() > 0
+}
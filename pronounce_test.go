@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGuessPronunciation(t *testing.T) {
+	tests := []struct {
+		morph         *Morph
+		pronunciation string
+		ok            bool
+	}{
+		{
+			&Morph{"まじ", "名詞", "形容動詞語幹", "*", "*", "*", "*", "まじ", "マジ", "マジ"},
+			"マジ",
+			true,
+		},
+		{
+			&Morph{"卍", "名詞", "一般", "*", "*", "*", "*", "*", "マンジ", "*"},
+			"マンジ",
+			true,
+		},
+		{
+			&Morph{"ぴえん", "名詞", "一般", "*", "*", "*", "*", "*", "", ""},
+			"ピエン",
+			true,
+		},
+		{
+			&Morph{"ヤバタニエン", "名詞", "固有名詞", "組織", "*", "*", "*", "*", "", ""},
+			"ヤバタニエン",
+			true,
+		},
+		{
+			&Morph{"DJ", "名詞", "固有名詞", "組織", "*", "*", "*", "*", "", ""},
+			"ディージェー",
+			true,
+		},
+		{
+			&Morph{"ｗ２", "名詞", "固有名詞", "組織", "*", "*", "*", "*", "", ""},
+			"ダブリューニ",
+			true,
+		},
+		{
+			&Morph{"草w", "名詞", "一般", "*", "*", "*", "*", "*", "", ""},
+			"",
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+		pronunciation, ok := guessPronunciation(test.morph)
+		if test.ok != ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+		if test.pronunciation != pronunciation {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.pronunciation, pronunciation)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,16 +16,35 @@ type Weight struct {
 	consonant, vowel float64
 }
 
+// FluencyScorer scores how fluent a sentence is between 0 and 1. 0 means
+// the sentence cannot be scored.
+type FluencyScorer interface {
+	Fluency(sentence Sentence) float64
+
+	// Generation increases when the fluency of sentences may change.
+	Generation() uint64
+}
+
 // Rapper makes nice lyrics.
 type Rapper struct {
 	weights   []Weight
 	maxWeight float64
 	thresh    float64
 	tryNum    int
+	rules     []*MorphRule // rules for valid sentences
+	meter     []int        // mora length of each line. It repeats. Empty means no constraint.
+	tolerance int          // allowed difference from meter.
+	format    LyricFormat  // format of posted lyrics
+	english   bool         // allow sentences with Latin-script words
+
+	fluency       FluencyScorer // It may be nil.
+	fluencyWeight float64       // weight of fluency against rhyme scores
+	candidates    int           // number of rhyming candidates for a line
 }
 
-// DefaultRapper returns default rapper
-func DefaultRapper() (*Rapper, error) {
+// DefaultRapper returns default rapper which scores fluency of lines with
+// fluency. fluency may be nil.
+func DefaultRapper(fluency FluencyScorer) (*Rapper, error) {
 	weights, err := parseWeights()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create rapper: weights: %w", err)
@@ -37,6 +57,42 @@ func DefaultRapper() (*Rapper, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot create rapper: tryNum: %w", err)
 	}
+	rules, err := LoadMorphRules()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rapper: %w", err)
+	}
+	var meter []int
+	for _, str := range envListDefault("METER", nil) {
+		val, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create rapper: meter: %w", err)
+		}
+		meter = append(meter, val)
+	}
+	tolerance, err := envIntDefault("METER_TOLERANCE", 1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rapper: %w", err)
+	}
+	format := LyricFormat(os.Getenv("LYRIC_FORMAT"))
+	if _, ok := lyricFormatters[format]; !ok && format != FormatNone {
+		return nil, fmt.Errorf("cannot create rapper: unknown LYRIC_FORMAT %q", format)
+	}
+
+	english, err := envBoolDefault("RAP_ALLOW_ENGLISH", false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rapper: %w", err)
+	}
+	fluencyWeight, err := envFloatDefault("FLUENCY_WEIGHT", 1.0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rapper: %w", err)
+	}
+	candidates, err := envIntDefault("RAP_CANDIDATES", 1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create rapper: %w", err)
+	}
+	if candidates < 1 {
+		return nil, fmt.Errorf("cannot create rapper: invalid RAP_CANDIDATES %d", candidates)
+	}
 
 	var maxWeight float64
 	for _, weight := range weights {
@@ -49,6 +105,15 @@ func DefaultRapper() (*Rapper, error) {
 		maxWeight: maxWeight,
 		thresh:    thresh,
 		tryNum:    tryNum,
+		rules:     rules,
+		meter:     meter,
+		tolerance: tolerance,
+		format:    format,
+		english:   english,
+
+		fluency:       fluency,
+		fluencyWeight: fluencyWeight,
+		candidates:    candidates,
 	}, nil
 }
 
@@ -90,46 +155,122 @@ func (rap *Rapper) LaunchRapServer(chLyric chan<- Lyric, chSentence <-chan Sente
 	return nil
 }
 
-// RapServer make lyrics forever.
+// RapServer make lyrics forever. Each line is the best of rap.candidates
+// rhyming sentences.
 func (rap *Rapper) RapServer(chLyric chan<- Lyric, chSentence <-chan Sentence, lineNum int) {
 mainLoop:
 	for {
-		lyric := []Sentence{<-chSentence}
-	lyricLoop:
+		first := <-chSentence
+		if !rap.FitsMeter(0, first) {
+			continue
+		}
+		lyric := []Sentence{first}
 		for len(lyric) < lineNum {
-			for try := 0; try < rap.tryNum; try++ {
-				// find pronounceable sentence
-				var sentence Sentence
-				for {
-					sentence = <-chSentence
-					if isValidRapSentence(sentence) {
-						break
-					}
+			var candidates []Sentence
+			for try := 0; try < rap.tryNum && len(candidates) < rap.candidates; try++ {
+				// unpronounceable sentences count as tries not to wait forever
+				sentence := <-chSentence
+				if !rap.isValidRapSentence(sentence) || !rap.FitsMeter(len(lyric), sentence) {
+					continue
 				}
 
 				// judge the lyric is valid
 				if rap.IsAppendable(lyric, sentence) {
-					lyric = append(lyric, sentence)
-					continue lyricLoop
+					candidates = append(candidates, sentence)
 				}
 			}
-			continue mainLoop
+			if len(candidates) == 0 {
+				continue mainLoop
+			}
+			lyric = append(lyric, rap.BestLine(lyric, candidates))
 		}
 		chLyric <- lyric
 	}
 }
 
+// BestLine returns the candidate which rhymes with the last line of lyric
+// and is fluent the most.
+func (rap *Rapper) BestLine(lyric Lyric, candidates []Sentence) Sentence {
+	var best Sentence
+	var bestScore float64
+	for _, candidate := range candidates {
+		score := rap.Distance(lyric[len(lyric)-1], candidate) + rap.fluencyWeight*rap.lineFluency(candidate)
+		if best == nil || score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+// lineFluency returns the fluency of sentence. It is 0 without FluencyScorer.
+func (rap *Rapper) lineFluency(sentence Sentence) float64 {
+	if rap.fluency == nil {
+		return 0
+	}
+	return rap.fluency.Fluency(sentence)
+}
+
+// Fluency returns the mean fluency of lines of lyric which can be scored.
+// If no line can be scored, ok is false.
+func (rap *Rapper) Fluency(lyric Lyric) (fluency float64, ok bool) {
+	var sum float64
+	var num int
+	for _, line := range lyric {
+		if f := rap.lineFluency(line); f > 0 {
+			sum += f
+			num++
+		}
+	}
+	if num == 0 {
+		return 0, false
+	}
+	return sum / float64(num), true
+}
+
+// fluencyGeneration returns the generation of FluencyScorer. It is 0
+// without FluencyScorer.
+func (rap *Rapper) fluencyGeneration() uint64 {
+	if rap.fluency == nil {
+		return 0
+	}
+	return rap.fluency.Generation()
+}
+
 // isValidRapSentence returns whether the sentence is valid for lyric.
-func isValidRapSentence(sentence Sentence) bool {
-	return true && // for easy comment out
-		sentence.IsPronounceable() &&
-		sentence[len(sentence)-1].ConjugatedForm2 != "連用タ接続" && // 「なかっ」
-		sentence[len(sentence)-1].ConjugatedForm2 != "連用形" && // 「（ありがとう）ござい」
-		sentence[len(sentence)-1].ConjugatedForm2 != "未然形" && // 「い（ない）」
-		sentence[len(sentence)-1].PartOfSpeech != "助詞" && // 「〇〇の」
-		(sentence[len(sentence)-1].PartOfSpeechSection1 != "接尾" ||
-			sentence[len(sentence)-1].PartOfSpeechSection2 != "人名") && // 「〇〇さん」
-		true // for easy comment out
+// Sentences with Latin-script words are valid only if RAP_ALLOW_ENGLISH is
+// set.
+func (rap *Rapper) isValidRapSentence(sentence Sentence) bool {
+	if len(sentence) == 0 || !sentence.IsPronounceable() {
+		return false
+	}
+	if !rap.english {
+		for _, morph := range sentence {
+			// acronyms such as "DJ" are allowed
+			if isEnglishWord(morph.Surface) && !isAcronym(morph.Surface) {
+				return false
+			}
+		}
+	}
+	for _, rule := range rap.rules {
+		if !rule.Accept(sentence) {
+			return false
+		}
+	}
+	return true
+}
+
+// FitsMeter returns whether the sentence has suitable mora length for the
+// line of the lyric.
+func (rap *Rapper) FitsMeter(line int, sentence Sentence) bool {
+	if len(rap.meter) == 0 {
+		return true
+	}
+	morae, ok := sentence.Morae()
+	if !ok {
+		return false
+	}
+	diff := len(morae) - rap.meter[line%len(rap.meter)]
+	return -rap.tolerance <= diff && diff <= rap.tolerance
 }
 
 // IsAppendable returns if sentence is suitable for lyric
@@ -167,6 +308,17 @@ func (rap *Rapper) Distance(sen1, sen2 Sentence) float64 {
 		return 0.0
 	}
 
+	var sum float64
+	rap.compareMorae(morae1, morae2, func(_, _ int, score, _ float64) {
+		sum += score
+	})
+	return sum / rap.maxWeight
+}
+
+// compareMorae compares morae1 and morae2 from their tails. f is called with
+// the indices of each pair of compared morae, the score of the pair and the
+// max score of the pair.
+func (rap *Rapper) compareMorae(morae1, morae2 Morae, f func(idx1, idx2 int, score, max float64)) {
 	minLength := len(rap.weights)
 	if len(morae1) < minLength {
 		minLength = len(morae1)
@@ -175,29 +327,106 @@ func (rap *Rapper) Distance(sen1, sen2 Sentence) float64 {
 		minLength = len(morae2)
 	}
 
-	var sum float64
 	for i := 0; i < minLength; i++ {
 		weight := rap.weights[len(rap.weights)-1-i]
-		mora1 := morae1[len(morae1)-1-i]
-		mora2 := morae2[len(morae2)-1-i]
+		idx1, idx2 := len(morae1)-1-i, len(morae2)-1-i
 
-		if mora1.consonant == mora2.consonant {
-			sum += weight.consonant
+		var score float64
+		if morae1[idx1].consonant == morae2[idx2].consonant {
+			score += weight.consonant
 		}
-		if mora1.vowel == mora2.vowel {
-			sum += weight.vowel
+		if morae1[idx1].vowel == morae2[idx2].vowel {
+			score += weight.vowel
 		}
+		f(idx1, idx2, score, weight.consonant+weight.vowel)
 	}
+}
 
-	return sum / rap.maxWeight
+// RhymeMarks returns whether each mora of each line rhymes with the previous
+// or the next line. Morae are scored in the same way as Distance, and a mora
+// rhymes if it gets at least half of its weights.
+// If a line is unpronounceable, its marks will be nil.
+func (rap *Rapper) RhymeMarks(lyric Lyric) [][]bool {
+	moraes := make([]Morae, len(lyric))
+	marks := make([][]bool, len(lyric))
+	for i, line := range lyric {
+		morae, ok := line.Morae()
+		if !ok {
+			continue
+		}
+		moraes[i] = morae
+		marks[i] = make([]bool, len(morae))
+	}
+
+	for i := 1; i < len(lyric); i++ {
+		rap.compareMorae(moraes[i-1], moraes[i], func(idx1, idx2 int, score, max float64) {
+			if max > 0 && 2*score >= max {
+				marks[i-1][idx1] = true
+				marks[i][idx2] = true
+			}
+		})
+	}
+	return marks
+}
+
+// Score returns the mean Distance of adjacent lines of lyric.
+func (rap *Rapper) Score(lyric Lyric) float64 {
+	if len(lyric) < 2 {
+		return 0.0
+	}
+
+	var sum float64
+	for i := 1; i < len(lyric); i++ {
+		sum += rap.Distance(lyric[i-1], lyric[i])
+	}
+	return sum / float64(len(lyric)-1)
 }
 
+// maxFluencyRefresh is the max number of lyrics whose stale fluency is
+// calculated again per pop. Fluency is calculated from the chains, so it
+// is too slow to calculate again for all lyrics every time the chains
+// change.
+const maxFluencyRefresh = 100
+
 // LyricStorage stores rhymes.
 type LyricStorage struct {
 	maxLen int
 	length int
 	mu     *sync.Mutex
-	lyrics *list.List
+	lyrics *list.List // of *storedLyric
+}
+
+// storedLyric is a lyric of LyricStorage. Its scores are cached because it
+// is scored many times.
+type storedLyric struct {
+	lyric Lyric
+
+	score  float64 // valid if scored
+	scored bool
+
+	fluency    float64 // valid if fluent
+	generation uint64  // generation of FluencyScorer when fluency is calculated
+	fluent     bool
+}
+
+// Score returns the rhyme score of the lyric.
+func (sl *storedLyric) Score(rapper *Rapper) float64 {
+	if !sl.scored {
+		sl.score = rapper.Score(sl.lyric)
+		sl.scored = true
+	}
+	return sl.score
+}
+
+// refreshFluency calculates the fluency of the lyric at generation of
+// FluencyScorer. If the lyric cannot be scored anymore, the last fluency is
+// kept not to penalize old lyrics.
+func (sl *storedLyric) refreshFluency(rapper *Rapper, generation uint64) {
+	if fluency, ok := rapper.Fluency(sl.lyric); ok {
+		sl.fluency = fluency
+	}
+	sl.generation = generation
+	sl.fluent = true
 }
 
 // NewLyricStorage returns new LyricStorage.
@@ -221,7 +450,7 @@ func (ls *LyricStorage) Push(lyric Lyric) {
 	ls.mu.Lock()
 	defer ls.mu.Unlock()
 
-	ls.lyrics.PushFront(lyric)
+	ls.lyrics.PushFront(&storedLyric{lyric: lyric})
 	ls.length++
 	if ls.length > ls.maxLen {
 		ls.lyrics.Remove(ls.lyrics.Back())
@@ -237,31 +466,79 @@ func (ls *LyricStorage) Pop() Lyric {
 	if ls.length == 0 {
 		return nil
 	}
+	return ls.remove(ls.lyrics.Front())
+}
 
-	lyric := ls.lyrics.Front().Value.(Lyric)
-	ls.lyrics.Remove(ls.lyrics.Front())
-	ls.length--
-	return lyric
+// PopBest returns the lyric which has the best combined score of rhyme and
+// fluency.
+func (ls *LyricStorage) PopBest(rapper *Rapper) Lyric {
+	return ls.popMax(rapper, func(sl *storedLyric) float64 {
+		return sl.Score(rapper) + rapper.fluencyWeight*sl.fluency
+	})
 }
 
-// ContinueLyric returns most suitable lyric.
+// ContinueLyric returns most suitable lyric. The first line of the lyric
+// rhymes with sentence, and the lyric is fluent.
 func (ls *LyricStorage) ContinueLyric(rapper *Rapper, sentence Sentence) Lyric {
+	return ls.popMax(rapper, func(sl *storedLyric) float64 {
+		return rapper.Distance(sentence, sl.lyric[0]) + rapper.fluencyWeight*sl.fluency
+	})
+}
+
+// popMax returns the lyric whose score is the max. The newer lyric is
+// returned if scores are the same.
+func (ls *LyricStorage) popMax(rapper *Rapper, score func(sl *storedLyric) float64) Lyric {
 	ls.mu.Lock()
 	defer ls.mu.Unlock()
 
 	if ls.length == 0 {
 		return nil
 	}
+	ls.refreshFluency(rapper)
 
 	most := ls.lyrics.Front()
-	distance := rapper.Distance(sentence, most.Value.(Lyric)[0])
-	for e := ls.lyrics.Front().Next(); e != nil; e = e.Next() {
-		if d := rapper.Distance(sentence, e.Value.(Lyric)[0]); d > distance {
+	max := score(most.Value.(*storedLyric))
+	for e := most.Next(); e != nil; e = e.Next() {
+		if s := score(e.Value.(*storedLyric)); s > max {
 			most = e
-			distance = d
+			max = s
+		}
+	}
+	return ls.remove(most)
+}
+
+// refreshFluency calculates the fluency of new lyrics, and of at most
+// maxFluencyRefresh stale lyrics in order of their generations. Other stale
+// lyrics keep the last fluency until later pops. ls.mu must be locked.
+func (ls *LyricStorage) refreshFluency(rapper *Rapper) {
+	if rapper.fluencyWeight == 0 {
+		return
+	}
+
+	generation := rapper.fluencyGeneration()
+	var stale []*storedLyric
+	for e := ls.lyrics.Front(); e != nil; e = e.Next() {
+		sl := e.Value.(*storedLyric)
+		switch {
+		case !sl.fluent:
+			sl.refreshFluency(rapper, generation)
+		case sl.generation != generation:
+			stale = append(stale, sl)
 		}
 	}
-	ls.lyrics.Remove(most)
+
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].generation < stale[j].generation })
+	if len(stale) > maxFluencyRefresh {
+		stale = stale[:maxFluencyRefresh]
+	}
+	for _, sl := range stale {
+		sl.refreshFluency(rapper, generation)
+	}
+}
+
+// remove removes e and returns its lyric.
+func (ls *LyricStorage) remove(e *list.Element) Lyric {
+	ls.lyrics.Remove(e)
 	ls.length--
-	return most.Value.(Lyric)
+	return e.Value.(*storedLyric).lyric
 }
@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
 
 func TestRapper_Distance(t *testing.T) {
 	tests := []struct {
@@ -113,3 +118,328 @@ func TestRapper_Distance(t *testing.T) {
 		}
 	}
 }
+
+func TestRapper_Score(t *testing.T) {
+	rapper := Rapper{
+		weights:   []Weight{{1.0, 1.0}},
+		maxWeight: 2.0,
+	}
+
+	tests := []struct {
+		lyric Lyric
+		score float64
+	}{
+		{
+			Lyric{
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "カ"}},
+			},
+			0.0,
+		},
+		{
+			Lyric{
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "カ"}},
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "サ"}},
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "サ"}},
+			},
+			(0.5 + 1.0) / 2,
+		},
+	}
+
+	for idx, test := range tests {
+		if score := rapper.Score(test.lyric); test.score != score {
+			t.Errorf("[%d] expected %f, but got %f", idx, test.score, score)
+		}
+	}
+}
+
+func TestRapper_RhymeMarks(t *testing.T) {
+	tests := []struct {
+		weights []Weight
+		lyric   Lyric
+		marks   [][]bool
+	}{
+		{
+			[]Weight{{1.0, 3.0}, {1.0, 3.0}},
+			Lyric{
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "カサ"}},
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "イタカ"}},
+			},
+			[][]bool{{true, true}, {false, true, true}},
+		},
+		{
+			[]Weight{{3.0, 1.0}},
+			Lyric{
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "カ"}},
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "キ"}},
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "サ"}},
+			},
+			[][]bool{{true}, {true}, {false}},
+		},
+		{
+			[]Weight{{1.0, 1.0}},
+			Lyric{
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "カ"}},
+				Sentence{&Morph{"", "", "", "", "", "", "", "", "", "ｗ"}},
+			},
+			[][]bool{{false}, nil},
+		},
+	}
+
+	for idx, test := range tests {
+		rapper := Rapper{weights: test.weights}
+		marks := rapper.RhymeMarks(test.lyric)
+		if fmt.Sprint(marks) != fmt.Sprint(test.marks) {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.marks, marks)
+		}
+	}
+}
+
+func TestRapper_FitsMeter(t *testing.T) {
+	rapper := Rapper{
+		meter:     []int{7, 5},
+		tolerance: 1,
+	}
+
+	tests := []struct {
+		line     int
+		sentence Sentence
+		fits     bool
+	}{
+		{0, Sentence{&Morph{"", "", "", "", "", "", "", "", "", "アイウエオカキ"}}, true},
+		{0, Sentence{&Morph{"", "", "", "", "", "", "", "", "", "アイウエオカ"}}, true},
+		{0, Sentence{&Morph{"", "", "", "", "", "", "", "", "", "アイウエオ"}}, false},
+		{1, Sentence{&Morph{"", "", "", "", "", "", "", "", "", "アイウエオ"}}, true},
+		{1, Sentence{&Morph{"", "", "", "", "", "", "", "", "", "キャッ"}}, false},
+		{3, Sentence{&Morph{"", "", "", "", "", "", "", "", "", "キャッキャー"}}, true},
+		{2, Sentence{&Morph{"", "", "", "", "", "", "", "", "", "ｗ"}}, false},
+	}
+
+	for idx, test := range tests {
+		if fits := rapper.FitsMeter(test.line, test.sentence); fits != test.fits {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.fits, fits)
+		}
+	}
+
+	if !(&Rapper{}).FitsMeter(0, Sentence{&Morph{"", "", "", "", "", "", "", "", "", "ア"}}) {
+		t.Errorf("expected no constraint without meter")
+	}
+}
+
+func TestRapper_RapServer_rejectedTries(t *testing.T) {
+	rapper := &Rapper{
+		weights:    []Weight{{1.0, 1.0}},
+		maxWeight:  2.0,
+		tryNum:     2,
+		meter:      []int{2},
+		candidates: 1,
+	}
+	chLyric := make(chan Lyric)
+	chSentence := make(chan Sentence)
+	go rapper.RapServer(chLyric, chSentence, 2)
+
+	// the first lyric is given up after two sentences which do not fit meter
+	go func() {
+		for _, pron := range []string{"カア", "ア", "ア", "サカ", "タア"} {
+			chSentence <- Sentence{&Morph{pron, "", "", "", "", "", "", "", "", pron}}
+		}
+	}()
+
+	select {
+	case lyric := <-chLyric:
+		if lyric[0].String() != "サカ" {
+			t.Errorf("expected %v, but got %v", "サカ", lyric)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("rejected sentences are not counted as tries")
+	}
+}
+
+// line returns a sentence of a morph which has surface and pronunciation.
+func line(surface, pronunciation string) Sentence {
+	return Sentence{&Morph{surface, "", "", "", "", "", "", "", "", pronunciation}}
+}
+
+// surfaceFluency scores sentences by the surface of the first morph.
+type surfaceFluency map[string]float64
+
+func (sf surfaceFluency) Fluency(sentence Sentence) float64 {
+	return sf[sentence[0].Surface]
+}
+
+func (sf surfaceFluency) Generation() uint64 {
+	return 0
+}
+
+// changingFluency is surfaceFluency whose generation can be changed.
+type changingFluency struct {
+	surfaceFluency
+	generation uint64
+}
+
+func (cf *changingFluency) Generation() uint64 {
+	return cf.generation
+}
+
+func TestRapper_BestLine(t *testing.T) {
+	lyric := Lyric{line("前", "カ")}
+
+	tests := []struct {
+		rapper     Rapper
+		candidates []Sentence
+		best       string
+	}{
+		{
+			Rapper{weights: []Weight{{1.0, 1.0}}, maxWeight: 2.0},
+			[]Sentence{line("あ", "サ"), line("い", "カ")},
+			"い",
+		},
+		{
+			Rapper{
+				weights:       []Weight{{1.0, 1.0}},
+				maxWeight:     2.0,
+				fluency:       surfaceFluency{"あ": 0.8, "い": 0.1},
+				fluencyWeight: 1.0,
+			},
+			[]Sentence{line("あ", "サ"), line("い", "カ")},
+			"あ",
+		},
+		{
+			Rapper{
+				weights:       []Weight{{1.0, 1.0}},
+				maxWeight:     2.0,
+				fluency:       surfaceFluency{"あ": 0.8, "い": 0.1},
+				fluencyWeight: 0.5,
+			},
+			[]Sentence{line("あ", "サ"), line("い", "カ")},
+			"い",
+		},
+	}
+
+	for idx, test := range tests {
+		if best := test.rapper.BestLine(lyric, test.candidates); best[0].Surface != test.best {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.best, best)
+		}
+	}
+}
+
+func TestLyricStorage_PopBest(t *testing.T) {
+	rapper := &Rapper{
+		weights:       []Weight{{1.0, 1.0}},
+		maxWeight:     2.0,
+		fluency:       surfaceFluency{"あ": 0.1, "い": 0.9, "う": 0.3},
+		fluencyWeight: 1.0,
+	}
+
+	ls := NewLyricStorage(10)
+	ls.Push(Lyric{line("あ", "カ"), line("あ", "カ")}) // rhymes: 1.0 + 0.1
+	ls.Push(Lyric{line("い", "カ"), line("い", "サ")}) // rhymes: 0.5 + 0.9
+	ls.Push(Lyric{line("う", "カ"), line("う", "キ")}) // rhymes: 0.5 + 0.3
+
+	for idx, first := range []string{"い", "あ", "う"} {
+		lyric := ls.PopBest(rapper)
+		if lyric == nil || lyric[0][0].Surface != first {
+			t.Errorf("[%d] expected %v, but got %v", idx, first, lyric)
+		}
+	}
+	if lyric := ls.PopBest(rapper); lyric != nil {
+		t.Errorf("expected nil, but got %v", lyric)
+	}
+}
+
+func TestLyricStorage_ContinueLyric(t *testing.T) {
+	sentence := line("", "カ")
+
+	tests := []struct {
+		fluencyWeight float64
+		first         string
+	}{
+		{0.0, "あ"},
+		{1.0, "い"},
+	}
+
+	for idx, test := range tests {
+		rapper := &Rapper{
+			weights:       []Weight{{1.0, 1.0}},
+			maxWeight:     2.0,
+			fluency:       surfaceFluency{"あ": 0.1, "い": 0.9},
+			fluencyWeight: test.fluencyWeight,
+		}
+		ls := NewLyricStorage(10)
+		ls.Push(Lyric{line("あ", "カ")}) // rhymes with sentence: 1.0
+		ls.Push(Lyric{line("い", "サ")}) // rhymes with sentence: 0.5
+
+		if lyric := ls.ContinueLyric(rapper, sentence); lyric[0][0].Surface != test.first {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.first, lyric)
+		}
+	}
+}
+
+func TestLyricStorage_refreshFluency(t *testing.T) {
+	fluency := &changingFluency{}
+	rapper := &Rapper{fluency: fluency, fluencyWeight: 1.0}
+	ls := NewLyricStorage(10)
+	ls.Push(Lyric{line("あ", "カ"), line("い", "カ")})
+	sl := ls.lyrics.Front().Value.(*storedLyric)
+
+	tests := []struct {
+		fluency    map[string]float64
+		generation uint64
+		expected   float64
+	}{
+		{map[string]float64{"あ": 0.5, "い": 0.2}, 0, 0.35},
+		{map[string]float64{"あ": 0.9, "い": 0.2}, 0, 0.35}, // cached
+		{map[string]float64{"あ": 0.9, "い": 0.3}, 1, 0.6},  // recalculated
+		{map[string]float64{"あ": 0.8}, 2, 0.8},            // unscorable line is skipped
+		{map[string]float64{}, 3, 0.8},                    // unscorable lyric keeps fluency
+		{map[string]float64{"あ": 0.1, "い": 0.1}, 4, 0.1},
+	}
+
+	for idx, test := range tests {
+		fluency.surfaceFluency = test.fluency
+		fluency.generation = test.generation
+		ls.refreshFluency(rapper)
+		if math.Abs(sl.fluency-test.expected) > 1e-9 {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.expected, sl.fluency)
+		}
+	}
+}
+
+// countingFluency counts sentences scored by changingFluency.
+type countingFluency struct {
+	changingFluency
+	count int
+}
+
+func (cf *countingFluency) Fluency(sentence Sentence) float64 {
+	cf.count++
+	return cf.changingFluency.Fluency(sentence)
+}
+
+func TestLyricStorage_refreshFluency_bounded(t *testing.T) {
+	fluency := &countingFluency{changingFluency: changingFluency{surfaceFluency: surfaceFluency{"あ": 0.5}}}
+	rapper := &Rapper{fluency: fluency, fluencyWeight: 1.0}
+	ls := NewLyricStorage(2 * maxFluencyRefresh)
+	for i := 0; i < maxFluencyRefresh+50; i++ {
+		ls.Push(Lyric{line("あ", "カ")})
+	}
+
+	tests := []struct {
+		generation uint64
+		count      int
+	}{
+		{0, maxFluencyRefresh + 50}, // new lyrics
+		{0, 0},
+		{1, maxFluencyRefresh},
+		{1, 48}, // the rest of 148 stale lyrics after one refreshed is popped
+		{1, 0},
+	}
+
+	for idx, test := range tests {
+		fluency.generation = test.generation
+		fluency.count = 0
+		ls.PopBest(rapper)
+		if fluency.count != test.count {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.count, fluency.count)
+		}
+	}
+}
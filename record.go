@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// RecordedMessage is a line of a record file. Message is the raw JSON sent by
+// the stream. Learnable is whether the tweet is learned. It is false for
+// messages which are not passed to the learn path.
+type RecordedMessage struct {
+	Time      time.Time       `json:"time"`
+	Stream    string          `json:"stream"`
+	Learnable bool            `json:"learnable"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// recordedStreams maps endpoints of streaming API to stream names.
+var recordedStreams = map[string]string{
+	"sample.json": "sample",
+	"filter.json": "reply",
+}
+
+// learnedStream is the stream whose tweets are recorded with the learnability
+// decision.
+const learnedStream = "sample"
+
+// maxUndecided is the max number of tweets waiting for the decision. If
+// more tweets wait, they are recorded as not learnable.
+const maxUndecided = 1000
+
+// TweetRecorder records raw stream messages to a JSONL file. The file is
+// rotated as path.1, path.2, ... when it becomes larger than maxBytes.
+type TweetRecorder struct {
+	path     string
+	maxBytes int64 // if maxBytes <= 0, the file is never rotated.
+	maxFiles int   // max number of rotated files.
+	mu       *sync.Mutex
+	file     *os.File
+	size     int64
+
+	// tweets of learnedStream waiting for the decision by their id_str
+	undecided map[string]RecordedMessage
+}
+
+// DefaultTweetRecorder uses .env values. If RECORD_FILE is not set, returns
+// nil.
+func DefaultTweetRecorder() (*TweetRecorder, error) {
+	path := os.Getenv("RECORD_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	maxMegaBytes, err := envIntDefault("RECORD_MAX_MEGABYTES", 100)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create recorder: %w", err)
+	}
+	maxFiles, err := envIntDefault("RECORD_MAX_FILES", 5)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create recorder: %w", err)
+	}
+	return NewTweetRecorder(path, int64(maxMegaBytes)<<20, maxFiles)
+}
+
+// NewTweetRecorder returns new TweetRecorder which appends to path.
+func NewTweetRecorder(path string, maxBytes int64, maxFiles int) (*TweetRecorder, error) {
+	tr := &TweetRecorder{
+		path:      path,
+		maxBytes:  maxBytes,
+		maxFiles:  maxFiles,
+		mu:        new(sync.Mutex),
+		undecided: map[string]RecordedMessage{},
+	}
+	if err := tr.open(); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// open opens the record file.
+func (tr *TweetRecorder) open() error {
+	f, err := os.OpenFile(tr.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open record file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("cannot open record file: %w", err)
+	}
+	tr.file = f
+	tr.size = info.Size()
+	return nil
+}
+
+// Record writes raw message of stream. Tweets of learnedStream are written
+// when Decide is called with their IDs.
+func (tr *TweetRecorder) Record(stream string, message []byte) error {
+	record := RecordedMessage{
+		Time:    time.Now(),
+		Stream:  stream,
+		Message: append(json.RawMessage(nil), message...),
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if stream == learnedStream {
+		if id := tweetIDStr(message); id != "" {
+			if len(tr.undecided) >= maxUndecided {
+				if err := tr.flushUndecided(); err != nil {
+					return err
+				}
+			}
+			tr.undecided[id] = record
+			return nil
+		}
+	}
+	return tr.write(record)
+}
+
+// Decide writes the tweet of id with the learnability decision. Unknown IDs
+// are ignored.
+func (tr *TweetRecorder) Decide(id string, learnable bool) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	record, ok := tr.undecided[id]
+	if !ok {
+		return nil
+	}
+	delete(tr.undecided, id)
+	record.Learnable = learnable
+	return tr.write(record)
+}
+
+// flushUndecided writes all tweets waiting for the decision as not
+// learnable.
+func (tr *TweetRecorder) flushUndecided() error {
+	records := make([]RecordedMessage, 0, len(tr.undecided))
+	for _, record := range tr.undecided {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	tr.undecided = map[string]RecordedMessage{}
+
+	for _, record := range records {
+		if err := tr.write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes record. tr.mu must be locked.
+func (tr *TweetRecorder) write(record RecordedMessage) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("cannot record tweet: %w", err)
+	}
+	line = append(line, '\n')
+
+	if tr.maxBytes > 0 && tr.size > 0 && tr.size+int64(len(line)) > tr.maxBytes {
+		if err := tr.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := tr.file.Write(line)
+	tr.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("cannot record tweet: %w", err)
+	}
+	return nil
+}
+
+// rotate renames path.(i) to path.(i+1) and opens new path.
+func (tr *TweetRecorder) rotate() error {
+	if err := tr.file.Close(); err != nil {
+		return fmt.Errorf("cannot rotate record file: %w", err)
+	}
+
+	if tr.maxFiles <= 0 {
+		if err := os.Remove(tr.path); err != nil {
+			return fmt.Errorf("cannot rotate record file: %w", err)
+		}
+		return tr.open()
+	}
+
+	for i := tr.maxFiles - 1; i > 0; i-- {
+		from := tr.path + "." + strconv.Itoa(i)
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Rename(from, tr.path+"."+strconv.Itoa(i+1)); err != nil {
+			return fmt.Errorf("cannot rotate record file: %w", err)
+		}
+	}
+	if err := os.Rename(tr.path, tr.path+".1"); err != nil {
+		return fmt.Errorf("cannot rotate record file: %w", err)
+	}
+	return tr.open()
+}
+
+// Close writes tweets waiting for the decision and closes the record file.
+func (tr *TweetRecorder) Close() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if err := tr.flushUndecided(); err != nil {
+		tr.file.Close()
+		return err
+	}
+	return tr.file.Close()
+}
+
+// Transport returns a RoundTripper which records messages of the streams in
+// recordedStreams while base reads them.
+func (tr *TweetRecorder) Transport(base http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{base: base, recorder: tr}
+}
+
+// recordingTransport records messages of streaming responses.
+type recordingTransport struct {
+	base     http.RoundTripper
+	recorder *TweetRecorder
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	stream, ok := recordedStreams[path.Base(req.URL.Path)]
+	if !ok {
+		return resp, nil
+	}
+	resp.Body = &recordingBody{ReadCloser: resp.Body, stream: stream, recorder: t.recorder}
+	return resp, nil
+}
+
+// recordingBody records each message delimited by CRLF as it is read.
+type recordingBody struct {
+	io.ReadCloser
+	stream   string
+	recorder *TweetRecorder
+	buf      []byte // incomplete message
+}
+
+// Read implements io.Reader.
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf = append(b.buf, p[:n]...)
+	for {
+		i := bytes.Index(b.buf, []byte("\r\n"))
+		if i < 0 {
+			break
+		}
+		// empty lines are keep-alive signals
+		if message := bytes.TrimSpace(b.buf[:i]); len(message) > 0 {
+			if err := b.recorder.Record(b.stream, message); err != nil {
+				log.Println(err)
+			}
+		}
+		b.buf = b.buf[i+2:]
+	}
+	b.buf = append([]byte(nil), b.buf...)
+	return n, err
+}
+
+// isTweetMessage returns whether the stream message of keys is a tweet. It is
+// the same rule as go-twitter.
+func isTweetMessage(keys map[string]json.RawMessage) bool {
+	_, ok := keys["retweet_count"]
+	return ok
+}
+
+// tweetIDStr returns id_str of the tweet message. If message is not a tweet,
+// returns "".
+func tweetIDStr(message []byte) string {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(message, &keys); err != nil || !isTweetMessage(keys) {
+		return ""
+	}
+	var id string
+	if err := json.Unmarshal(keys["id_str"], &id); err != nil {
+		return ""
+	}
+	return id
+}
+
+// ReplayTweets reads recorded messages from r and passes tweets to the
+// handler of their stream. Messages of streams without handlers and
+// messages other than tweets are skipped. Tweets are replayed at speed times
+// the original speed. If speed <= 0, tweets are replayed without waiting.
+func ReplayTweets(r io.Reader, handlers map[string]func(*twitter.Tweet), speed float64, sleep func(time.Duration)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var last time.Time
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record RecordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("cannot replay line %d: %w", line, err)
+		}
+		handle, ok := handlers[record.Stream]
+		if !ok {
+			continue
+		}
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(record.Message, &keys); err != nil {
+			return fmt.Errorf("cannot replay line %d: %w", line, err)
+		}
+		if !isTweetMessage(keys) {
+			continue
+		}
+		tweet := new(twitter.Tweet)
+		if err := json.Unmarshal(record.Message, tweet); err != nil {
+			return fmt.Errorf("cannot replay line %d: %w", line, err)
+		}
+
+		if speed > 0 && !last.IsZero() && record.Time.After(last) {
+			sleep(time.Duration(float64(record.Time.Sub(last)) / speed))
+		}
+		last = record.Time
+
+		handle(tweet)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot replay: %w", err)
+	}
+	return nil
+}
+
+// ReplayFile replays recorded tweets in path.
+func ReplayFile(path string, handlers map[string]func(*twitter.Tweet), speed float64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot replay: %w", err)
+	}
+	defer f.Close()
+
+	return ReplayTweets(f, handlers, speed, time.Sleep)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+func TestTweetRecorder_Record(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rapbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tweets.jsonl")
+
+	tr, err := NewTweetRecorder(path, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := tr.Record("sample", []byte(`{"id":`+strconv.Itoa(i)+`,"text":"テスト","retweet_count":0}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"tweets.jsonl", "tweets.jsonl.1", "tweets.jsonl.2"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%v: %v", name, err)
+			continue
+		}
+		if info.Size() > 300 {
+			t.Errorf("%v: expected size <= 300, but got %v", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tweets.jsonl.3")); !os.IsNotExist(err) {
+		t.Errorf("expected no tweets.jsonl.3, but got %v", err)
+	}
+}
+
+func TestTweetRecorder_Decide(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rapbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tweets.jsonl")
+
+	tr, err := NewTweetRecorder(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []struct {
+		stream, message string
+	}{
+		{"sample", `{"id_str":"1","retweet_count":0}`},
+		{"sample", `{"id_str":"2","retweet_count":0}`},
+		{"sample", `{"limit":{"track":10}}`},
+		{"reply", `{"id_str":"3","retweet_count":0}`},
+		{"sample", `{"id_str":"4","retweet_count":0}`},
+	}
+	for _, m := range messages {
+		if err := tr.Record(m.stream, []byte(m.message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"2", "1", "3", "5"} {
+		if err := tr.Decide(id, id == "2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected := []struct {
+		message   string
+		learnable bool
+	}{
+		{`{"limit":{"track":10}}`, false},
+		{`{"id_str":"3","retweet_count":0}`, false},
+		{`{"id_str":"2","retweet_count":0}`, true},
+		{`{"id_str":"1","retweet_count":0}`, false},
+		{`{"id_str":"4","retweet_count":0}`, false}, // undecided
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %v lines, but got %v", len(expected), lines)
+	}
+	for i, line := range lines {
+		var record RecordedMessage
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if string(record.Message) != expected[i].message || record.Learnable != expected[i].learnable {
+			t.Errorf("[%d] expected %v, but got %v", i, expected[i], line)
+		}
+	}
+}
+
+func TestRecordingBody_Read(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rapbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tweets.jsonl")
+
+	tr, err := NewTweetRecorder(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "{\"id\":1,\"retweet_count\":0}\r\n\r\n{\"warning\":{\"code\":\"FALLING_BEHIND\"}}\r\n{\"id\":2"
+	body := &recordingBody{ReadCloser: ioutil.NopCloser(bytes.NewBufferString(input)), stream: "sample", recorder: tr}
+	// read in small chunks to split messages
+	read, err := ioutil.ReadAll(iotest.OneByteReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != input {
+		t.Errorf("expected %q, but got %q", input, read)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected := []string{`{"id":1,"retweet_count":0}`, `{"warning":{"code":"FALLING_BEHIND"}}`}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %v, but got %v", expected, lines)
+	}
+	for i, line := range lines {
+		var record RecordedMessage
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Stream != "sample" || string(record.Message) != expected[i] {
+			t.Errorf("[%d] expected %v, but got %v", i, expected[i], line)
+		}
+	}
+}
+
+func TestReplayTweets(t *testing.T) {
+	input := `{"time":"2020-01-01T00:00:00Z","stream":"sample","message":{"id":1,"text":"あ","retweet_count":0}}
+
+{"time":"2020-01-01T00:00:05Z","stream":"sample","message":{"limit":{"track":10}}}
+{"time":"2020-01-01T00:00:10Z","stream":"reply","message":{"id":2,"text":"い","retweet_count":0}}
+{"time":"2020-01-01T00:00:20Z","stream":"other","message":{"id":4,"text":"え","retweet_count":0}}
+{"time":"2020-01-01T00:00:30Z","stream":"sample","message":{"id":3,"text":"う","retweet_count":0}}
+`
+
+	tests := []struct {
+		speed  float64
+		sleeps []time.Duration
+	}{
+		{1.0, []time.Duration{10 * time.Second, 20 * time.Second}},
+		{10.0, []time.Duration{time.Second, 2 * time.Second}},
+		{0.0, nil},
+	}
+
+	for idx, test := range tests {
+		var ids []int64
+		var sleeps []time.Duration
+		var replies []int64
+		handlers := map[string]func(*twitter.Tweet){
+			"sample": func(tweet *twitter.Tweet) { ids = append(ids, tweet.ID) },
+			"reply":  func(tweet *twitter.Tweet) { replies = append(replies, tweet.ID) },
+		}
+		err := ReplayTweets(bytes.NewBufferString(input), handlers, test.speed, func(d time.Duration) {
+			sleeps = append(sleeps, d)
+		})
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+		}
+		if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+			t.Errorf("[%d] expected [1 3], but got %v", idx, ids)
+		}
+		if len(replies) != 1 || replies[0] != 2 {
+			t.Errorf("[%d] expected [2], but got %v", idx, replies)
+		}
+		if len(sleeps) != len(test.sleeps) {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.sleeps, sleeps)
+			continue
+		}
+		for i := range sleeps {
+			if sleeps[i] != test.sleeps[i] {
+				t.Errorf("[%d] expected %v, but got %v", idx, test.sleeps, sleeps)
+			}
+		}
+	}
+}
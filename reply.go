@@ -0,0 +1,174 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// ReplyGuard protects the account from reply spams and bot-to-bot loops.
+// Replies over the rate limits are deferred in the queue.
+type ReplyGuard struct {
+	screenName    string
+	userLimiter   *RateLimiter // per-user rate limit
+	globalLimiter *RateLimiter // rate limit of all replies
+	blockList     map[string]bool
+	allowList     map[string]bool // not regarded as bots and no per-user limit
+	botKeywords   []string
+	maxQueueLen   int
+	mu            *sync.Mutex
+	queue         *list.List
+}
+
+// DefaultReplyGuard uses .env values.
+func DefaultReplyGuard() (*ReplyGuard, error) {
+	userLimit, err := envIntDefault("REPLY_USER_LIMIT", 3)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create reply guard: %w", err)
+	}
+	userWindow, err := envIntDefault("REPLY_USER_WINDOW_MINUTES", 60)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create reply guard: %w", err)
+	}
+	globalLimit, err := envIntDefault("REPLY_GLOBAL_LIMIT", 30)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create reply guard: %w", err)
+	}
+	globalWindow, err := envIntDefault("REPLY_GLOBAL_WINDOW_MINUTES", 15)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create reply guard: %w", err)
+	}
+	maxQueueLen, err := envIntDefault("REPLY_QUEUE_SIZE", 100)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create reply guard: %w", err)
+	}
+
+	return &ReplyGuard{
+		screenName:    normalizeScreenName(os.Getenv("TWITTER_SCREENNAME")),
+		userLimiter:   NewRateLimiter(userLimit, time.Duration(userWindow)*time.Minute),
+		globalLimiter: NewRateLimiter(globalLimit, time.Duration(globalWindow)*time.Minute),
+		blockList:     screenNameSet(envListDefault("REPLY_BLOCK_LIST", nil)),
+		allowList:     screenNameSet(envListDefault("REPLY_ALLOW_LIST", nil)),
+		botKeywords:   envListDefault("REPLY_BOT_KEYWORDS", []string{"bot"}),
+		maxQueueLen:   maxQueueLen,
+		mu:            new(sync.Mutex),
+		queue:         list.New(),
+	}, nil
+}
+
+// normalizeScreenName returns lower case name without leading "@".
+func normalizeScreenName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "@"))
+}
+
+// screenNameSet returns a set of normalized screen names.
+func screenNameSet(names []string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[normalizeScreenName(name)] = true
+	}
+	return set
+}
+
+// IsReplyable returns whether the tweet should be replied.
+// Own tweets, retweets, blocked users and bots are ignored.
+func (rg *ReplyGuard) IsReplyable(tweet *twitter.Tweet) bool {
+	if tweet.User == nil || tweet.RetweetedStatus != nil {
+		return false
+	}
+
+	name := strings.ToLower(tweet.User.ScreenName)
+	if name == rg.screenName || rg.blockList[name] {
+		return false
+	}
+	if rg.allowList[name] {
+		return true
+	}
+	return !rg.isBot(tweet)
+}
+
+// isBot returns whether the tweet seems to be posted by a bot.
+func (rg *ReplyGuard) isBot(tweet *twitter.Tweet) bool {
+	name := strings.ToLower(tweet.User.ScreenName)
+	source := strings.ToLower(sourceName(tweet.Source))
+	for _, keyword := range rg.botKeywords {
+		keyword = strings.ToLower(keyword)
+		if strings.Contains(name, keyword) || strings.Contains(source, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceName extracts client name from the source html of a tweet.
+func sourceName(source string) string {
+	if i := strings.Index(source, ">"); i >= 0 {
+		source = source[i+1:]
+	}
+	if i := strings.Index(source, "<"); i >= 0 {
+		source = source[:i]
+	}
+	return source
+}
+
+// Push adds tweet to the reply queue. If the queue is full, returns false.
+func (rg *ReplyGuard) Push(tweet *twitter.Tweet) bool {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	if rg.maxQueueLen > 0 && rg.queue.Len() >= rg.maxQueueLen {
+		return false
+	}
+	rg.queue.PushBack(tweet)
+	return true
+}
+
+// Pop returns the oldest tweet which can be replied at now under the rate
+// limits. If there is no such tweet, returns nil.
+func (rg *ReplyGuard) Pop(now time.Time) *twitter.Tweet {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	if !rg.globalLimiter.Ready("", now) {
+		return nil
+	}
+
+	for e := rg.queue.Front(); e != nil; e = e.Next() {
+		tweet := e.Value.(*twitter.Tweet)
+		name := strings.ToLower(tweet.User.ScreenName)
+		if !rg.allowList[name] && !rg.userLimiter.Ready(name, now) {
+			continue
+		}
+
+		rg.userLimiter.Record(name, now)
+		rg.globalLimiter.Record("", now)
+		rg.queue.Remove(e)
+		return tweet
+	}
+	return nil
+}
+
+// Len returns the number of deferred replies.
+func (rg *ReplyGuard) Len() int {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+
+	return rg.queue.Len()
+}
+
+// ReplyServer serves queued replies forever.
+func (rg *ReplyGuard) ReplyServer(serve func(*twitter.Tweet)) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for tweet := rg.Pop(now); tweet != nil; tweet = rg.Pop(now) {
+			serve(tweet)
+		}
+	}
+}
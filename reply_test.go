@@ -0,0 +1,141 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+func newTestReplyGuard() *ReplyGuard {
+	return &ReplyGuard{
+		screenName:    "rapbot",
+		userLimiter:   NewRateLimiter(1, time.Hour),
+		globalLimiter: NewRateLimiter(2, time.Hour),
+		blockList:     screenNameSet([]string{"@Spammer"}),
+		allowList:     screenNameSet([]string{"friend_bot"}),
+		botKeywords:   []string{"bot"},
+		maxQueueLen:   3,
+		mu:            new(sync.Mutex),
+		queue:         list.New(),
+	}
+}
+
+func TestReplyGuard_IsReplyable(t *testing.T) {
+	tests := []struct {
+		tweet *twitter.Tweet
+		ok    bool
+	}{
+		{
+			&twitter.Tweet{User: &twitter.User{ScreenName: "alice"}},
+			true,
+		},
+		{
+			&twitter.Tweet{User: &twitter.User{ScreenName: "RapBot"}},
+			false,
+		},
+		{
+			&twitter.Tweet{User: &twitter.User{ScreenName: "spammer"}},
+			false,
+		},
+		{
+			&twitter.Tweet{User: &twitter.User{ScreenName: "other_bot"}},
+			false,
+		},
+		{
+			&twitter.Tweet{
+				User:   &twitter.User{ScreenName: "alice"},
+				Source: `<a href="https://example.com" rel="nofollow">AutoReplyBot</a>`,
+			},
+			false,
+		},
+		{
+			&twitter.Tweet{User: &twitter.User{ScreenName: "friend_bot"}},
+			true,
+		},
+		{
+			&twitter.Tweet{
+				User:            &twitter.User{ScreenName: "alice"},
+				RetweetedStatus: &twitter.Tweet{},
+			},
+			false,
+		},
+	}
+
+	rg := newTestReplyGuard()
+	for idx, test := range tests {
+		if ok := rg.IsReplyable(test.tweet); ok != test.ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+	}
+}
+
+func TestDefaultReplyGuard_screenName(t *testing.T) {
+	old, ok := os.LookupEnv("TWITTER_SCREENNAME")
+	defer func() {
+		if ok {
+			os.Setenv("TWITTER_SCREENNAME", old)
+		} else {
+			os.Unsetenv("TWITTER_SCREENNAME")
+		}
+	}()
+	os.Setenv("TWITTER_SCREENNAME", "@Rapper")
+
+	rg, err := DefaultReplyGuard()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		screenName string
+		ok         bool
+	}{
+		{"rapper", false},
+		{"Rapper", false},
+		{"alice", true},
+	}
+
+	for idx, test := range tests {
+		tweet := &twitter.Tweet{User: &twitter.User{ScreenName: test.screenName}}
+		if ok := rg.IsReplyable(tweet); ok != test.ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, ok)
+		}
+	}
+}
+
+func TestReplyGuard_Pop(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rg := newTestReplyGuard()
+
+	tweets := []*twitter.Tweet{
+		{ID: 1, User: &twitter.User{ScreenName: "alice"}},
+		{ID: 2, User: &twitter.User{ScreenName: "alice"}},
+		{ID: 3, User: &twitter.User{ScreenName: "bob"}},
+		{ID: 4, User: &twitter.User{ScreenName: "carol"}},
+	}
+	for idx, tweet := range tweets {
+		if ok := rg.Push(tweet); ok != (idx < 3) {
+			t.Errorf("[%d] push: expected %v, but got %v", idx, idx < 3, ok)
+		}
+	}
+
+	// alice is limited per user, and the global limit is 2.
+	expected := []int64{1, 3, 0}
+	for idx, id := range expected {
+		var got int64
+		if tweet := rg.Pop(now); tweet != nil {
+			got = tweet.ID
+		}
+		if got != id {
+			t.Errorf("[%d] expected %v, but got %v", idx, id, got)
+		}
+	}
+
+	// deferred reply is served after the window.
+	if tweet := rg.Pop(now.Add(time.Hour)); tweet == nil || tweet.ID != 2 {
+		t.Errorf("expected deferred tweet 2, but got %v", tweet)
+	}
+}
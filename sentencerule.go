@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// MorphRule is a rule of a sentence which judges its morphs.
+//
+// A morph matches the rule if all of Fields are equal to and all of Patterns
+// match the morph's fields. The keys are field names of Morph such as
+// "Surface" or "PartOfSpeech".
+// Position is "first", "last" or "any" (default). The sentence matches if
+// the morph at Position matches.
+// If Deny is true, the sentence is rejected when it matches. Otherwise the
+// sentence is rejected when it does not match.
+type MorphRule struct {
+	Name     string            `json:"name"`
+	Position string            `json:"position,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Patterns map[string]string `json:"patterns,omitempty"`
+	Deny     bool              `json:"deny,omitempty"`
+	res      map[string]*regexp.Regexp
+}
+
+// morphFields extract fields of a morph.
+var morphFields = map[string]func(*Morph) string{
+	"Surface":              func(m *Morph) string { return m.Surface },
+	"PartOfSpeech":         func(m *Morph) string { return m.PartOfSpeech },
+	"PartOfSpeechSection1": func(m *Morph) string { return m.PartOfSpeechSection1 },
+	"PartOfSpeechSection2": func(m *Morph) string { return m.PartOfSpeechSection2 },
+	"PartOfSpeechSection3": func(m *Morph) string { return m.PartOfSpeechSection3 },
+	"ConjugatedForm1":      func(m *Morph) string { return m.ConjugatedForm1 },
+	"ConjugatedForm2":      func(m *Morph) string { return m.ConjugatedForm2 },
+	"Inflection":           func(m *Morph) string { return m.Inflection },
+	"Reading":              func(m *Morph) string { return m.Reading },
+	"Pronunciation":        func(m *Morph) string { return m.Pronunciation },
+}
+
+// compile validates the rule and prepares its regexps.
+func (r *MorphRule) compile() error {
+	switch r.Position {
+	case "":
+		r.Position = "any"
+	case "first", "last", "any":
+	default:
+		return fmt.Errorf("rule %v: unknown position %q", r.Name, r.Position)
+	}
+
+	for field := range r.Fields {
+		if _, ok := morphFields[field]; !ok {
+			return fmt.Errorf("rule %v: unknown field %q", r.Name, field)
+		}
+	}
+	r.res = map[string]*regexp.Regexp{}
+	for field, pattern := range r.Patterns {
+		if _, ok := morphFields[field]; !ok {
+			return fmt.Errorf("rule %v: unknown field %q", r.Name, field)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("rule %v: %w", r.Name, err)
+		}
+		r.res[field] = re
+	}
+	return nil
+}
+
+// MatchMorph returns whether the morph matches the rule.
+func (r *MorphRule) MatchMorph(morph *Morph) bool {
+	for field, value := range r.Fields {
+		if morphFields[field](morph) != value {
+			return false
+		}
+	}
+	for field, re := range r.res {
+		if !re.MatchString(morphFields[field](morph)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns whether the sentence matches the rule.
+func (r *MorphRule) Match(sentence Sentence) bool {
+	if len(sentence) == 0 {
+		return false
+	}
+
+	switch r.Position {
+	case "first":
+		return r.MatchMorph(sentence[0])
+	case "last":
+		return r.MatchMorph(sentence[len(sentence)-1])
+	}
+	for _, morph := range sentence {
+		if r.MatchMorph(morph) {
+			return true
+		}
+	}
+	return false
+}
+
+// Accept returns whether the sentence passes the rule.
+func (r *MorphRule) Accept(sentence Sentence) bool {
+	return r.Match(sentence) != r.Deny
+}
+
+// DefaultMorphRules are used when no rule file is given. They are for both
+// the IPA dictionary and UniDic.
+func DefaultMorphRules() []*MorphRule {
+	rules := []*MorphRule{
+		{
+			Name:     "連用タ接続", // 「なかっ」
+			Position: "last",
+			Fields:   map[string]string{"ConjugatedForm2": "連用タ接続"},
+			Deny:     true,
+		},
+		{
+			Name:     "連用形", // 「（ありがとう）ござい」
+			Position: "last",
+			Fields:   map[string]string{"ConjugatedForm2": "連用形"},
+			Deny:     true,
+		},
+		{
+			Name:     "未然形", // 「い（ない）」
+			Position: "last",
+			Fields:   map[string]string{"ConjugatedForm2": "未然形"},
+			Deny:     true,
+		},
+		{
+			Name:     "助詞", // 「〇〇の」
+			Position: "last",
+			Fields:   map[string]string{"PartOfSpeech": "助詞"},
+			Deny:     true,
+		},
+		{
+			Name:     "接尾人名", // 「〇〇さん」
+			Position: "last",
+			Fields:   map[string]string{"PartOfSpeechSection1": "接尾", "PartOfSpeechSection2": "人名"},
+			Deny:     true,
+		},
+		{
+			Name:     "連用形・未然形 (UniDic)", // 「なかっ」「ござい」「い（ない）」
+			Position: "last",
+			Patterns: map[string]string{"ConjugatedForm2": "^(連用形|未然形)-"},
+			Deny:     true,
+		},
+	}
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			panic(err)
+		}
+	}
+	return rules
+}
+
+// LoadMorphRules reads rules from RAP_RULES_FILE as a JSON array of
+// MorphRule. If it is not set, DefaultMorphRules will be used.
+func LoadMorphRules() ([]*MorphRule, error) {
+	rules := DefaultMorphRules()
+
+	if path := os.Getenv("RAP_RULES_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read rap rules: %w", err)
+		}
+		defer f.Close()
+
+		rules = nil
+		if err := json.NewDecoder(f).Decode(&rules); err != nil {
+			return nil, fmt.Errorf("cannot read rap rules: %w", err)
+		}
+	}
+
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid rap rules: %w", err)
+		}
+	}
+	return rules, nil
+}
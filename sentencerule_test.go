@@ -0,0 +1,125 @@
+package main
+
+import "testing"
+
+func TestRapper_isValidRapSentence(t *testing.T) {
+	var (
+		ohayou  = &Morph{"おはよう", "感動詞", "*", "*", "*", "*", "*", "おはよう", "オハヨウ", "オハヨー"}
+		gozai   = &Morph{"ござい", "助動詞", "*", "*", "*", "五段・ラ行特殊", "連用形", "ござる", "ゴザイ", "ゴザイ"}
+		masu    = &Morph{"ます", "助動詞", "*", "*", "*", "特殊・マス", "基本形", "ます", "マス", "マス"}
+		naka    = &Morph{"なかっ", "助動詞", "*", "*", "*", "特殊・ナイ", "連用タ接続", "ない", "ナカッ", "ナカッ"}
+		i       = &Morph{"い", "動詞", "自立", "*", "*", "一段", "未然形", "いる", "イ", "イ"}
+		no      = &Morph{"の", "助詞", "連体化", "*", "*", "*", "*", "の", "ノ", "ノ"}
+		tanaka  = &Morph{"田中", "名詞", "固有名詞", "人名", "姓", "*", "*", "田中", "タナカ", "タナカ"}
+		san     = &Morph{"さん", "名詞", "接尾", "人名", "*", "*", "*", "さん", "サン", "サン"}
+		kedo    = &Morph{"けど", "助詞", "接続助詞", "*", "*", "*", "*", "けど", "ケド", "ケド"}
+		unknown = &Morph{"ｗｗ", "名詞", "サ変接続", "*", "*", "*", "*", "*", "", ""}
+		uniNaka = &Morph{"なかっ", "助動詞", "*", "*", "*", "助動詞-ナイ", "連用形-促音便", "ない", "ナカッ", "ナカッ"}
+		uniMasu = &Morph{"ます", "助動詞", "*", "*", "*", "助動詞-マス", "終止形-一般", "ます", "マス", "マス"}
+	)
+
+	tests := []struct {
+		rules    []*MorphRule
+		sentence Sentence
+		valid    bool
+	}{
+		{DefaultMorphRules(), Sentence{ohayou, gozai, masu}, true},
+		{DefaultMorphRules(), Sentence{ohayou, gozai}, false},
+		{DefaultMorphRules(), Sentence{naka}, false},
+		{DefaultMorphRules(), Sentence{i}, false},
+		{DefaultMorphRules(), Sentence{tanaka, no}, false},
+		{DefaultMorphRules(), Sentence{tanaka, san}, false},
+		{DefaultMorphRules(), Sentence{tanaka}, true},
+		{DefaultMorphRules(), Sentence{ohayou, unknown}, false},
+		{DefaultMorphRules(), Sentence{}, false},
+		{DefaultMorphRules(), Sentence{uniNaka}, false},
+		{DefaultMorphRules(), Sentence{ohayou, uniMasu}, true},
+		{
+			[]*MorphRule{{Position: "any", Fields: map[string]string{"PartOfSpeech": "名詞"}}},
+			Sentence{ohayou, gozai, masu},
+			false,
+		},
+		{
+			[]*MorphRule{{Position: "any", Fields: map[string]string{"PartOfSpeech": "名詞"}}},
+			Sentence{tanaka, san},
+			true,
+		},
+		{
+			[]*MorphRule{{Position: "last", Fields: map[string]string{"PartOfSpeechSection1": "接続助詞"}, Deny: true}},
+			Sentence{tanaka, kedo},
+			false,
+		},
+		{
+			[]*MorphRule{{Position: "first", Patterns: map[string]string{"Pronunciation": "^オ"}}},
+			Sentence{ohayou, masu},
+			true,
+		},
+		{
+			[]*MorphRule{{Position: "first", Patterns: map[string]string{"Pronunciation": "^オ"}}},
+			Sentence{masu, ohayou},
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+		for _, rule := range test.rules {
+			if err := rule.compile(); err != nil {
+				t.Fatalf("[%d] unexpected error: %v", idx, err)
+			}
+		}
+		rap := Rapper{rules: test.rules}
+		if valid := rap.isValidRapSentence(test.sentence); valid != test.valid {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.valid, valid)
+		}
+	}
+}
+
+func TestMorphRule_compile(t *testing.T) {
+	tests := []struct {
+		rule *MorphRule
+		ok   bool
+	}{
+		{&MorphRule{Fields: map[string]string{"Surface": "あ"}}, true},
+		{&MorphRule{Position: "middle"}, false},
+		{&MorphRule{Fields: map[string]string{"surface": "あ"}}, false},
+		{&MorphRule{Patterns: map[string]string{"Surface": "("}}, false},
+	}
+
+	for idx, test := range tests {
+		if err := test.rule.compile(); (err == nil) != test.ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, err)
+		}
+	}
+}
+
+func TestRapper_isValidRapSentence_english(t *testing.T) {
+	var (
+		money = &Morph{"money", "名詞", "固有名詞", "組織", "*", "*", "*", "*", "", "マネー"}
+		space = &Morph{" ", "記号", "空白", "*", "*", "*", "*", "*", "", ""}
+		flow  = &Morph{"flow", "名詞", "固有名詞", "組織", "*", "*", "*", "*", "", "フロー"}
+		kane  = &Morph{"金", "名詞", "一般", "*", "*", "*", "*", "金", "カネ", "カネ"}
+		dj    = &Morph{"DJ", "名詞", "固有名詞", "組織", "*", "*", "*", "*", "", "ディージェー"}
+		hello = &Morph{"HELLO", "名詞", "固有名詞", "組織", "*", "*", "*", "*", "", "ハロー"}
+	)
+
+	tests := []struct {
+		english  bool
+		sentence Sentence
+		valid    bool
+	}{
+		{false, Sentence{money, space, flow}, false},
+		{true, Sentence{money, space, flow}, true},
+		{false, Sentence{kane}, true},
+		{true, Sentence{kane}, true},
+		{false, Sentence{dj, kane}, true},
+		{false, Sentence{hello, kane}, false},
+		{true, Sentence{hello, kane}, true},
+	}
+
+	for idx, test := range tests {
+		rap := Rapper{rules: DefaultMorphRules(), english: test.english}
+		if valid := rap.isValidRapSentence(test.sentence); valid != test.valid {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.valid, valid)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+// StreamHealth is a health of a stream.
+type StreamHealth struct {
+	Connected   bool
+	ConnectedAt time.Time
+	LastMessage time.Time
+	LastTweet   time.Time
+	Tweets      int64
+	Undelivered int64 // number of tweets reported by limit notices
+	Reconnects  int
+	LastWarning string
+	LastError   string
+}
+
+// streamOpener opens a stream and returns its messages and stop function.
+type streamOpener func() (messages <-chan interface{}, stop func(), err error)
+
+// twitterStreamOpener converts open into streamOpener.
+func twitterStreamOpener(open func() (*twitter.Stream, error)) streamOpener {
+	return func() (<-chan interface{}, func(), error) {
+		stream, err := open()
+		if err != nil {
+			return nil, nil, err
+		}
+		stop := func() {
+			// drain messages not to block the stream goroutine
+			go func() {
+				for range stream.Messages {
+				}
+			}()
+			stream.Stop()
+		}
+		return stream.Messages, stop, nil
+	}
+}
+
+// StreamSupervisor keeps a stream alive. It reconnects with backoff when the
+// stream is disconnected or stalled.
+type StreamSupervisor struct {
+	name         string
+	open         streamOpener
+	handleTweet  func(*twitter.Tweet)
+	stallTimeout time.Duration // if no message in this duration, reconnect. 0 means no timeout.
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	mu           *sync.Mutex
+	health       StreamHealth
+}
+
+// DefaultStreamSupervisor uses .env values. If stall is false, the stream is
+// never regarded as stalled.
+func DefaultStreamSupervisor(name string, open func() (*twitter.Stream, error),
+	handleTweet func(*twitter.Tweet), stall bool) (*StreamSupervisor, error) {
+	var stallTimeout int
+	if stall {
+		var err error
+		stallTimeout, err = envIntDefault("STREAM_STALL_SECONDS", 90)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create %v stream: %w", name, err)
+		}
+	}
+	backoff, err := envIntDefault("STREAM_BACKOFF_SECONDS", 5)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create %v stream: %w", name, err)
+	}
+	maxBackoff, err := envIntDefault("STREAM_MAX_BACKOFF_SECONDS", 320)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create %v stream: %w", name, err)
+	}
+
+	return NewStreamSupervisor(name, twitterStreamOpener(open), handleTweet,
+		time.Duration(stallTimeout)*time.Second,
+		time.Duration(backoff)*time.Second,
+		time.Duration(maxBackoff)*time.Second), nil
+}
+
+// NewStreamSupervisor returns new StreamSupervisor.
+func NewStreamSupervisor(name string, open streamOpener, handleTweet func(*twitter.Tweet),
+	stallTimeout, backoff, maxBackoff time.Duration) *StreamSupervisor {
+	return &StreamSupervisor{
+		name:         name,
+		open:         open,
+		handleTweet:  handleTweet,
+		stallTimeout: stallTimeout,
+		backoff:      backoff,
+		maxBackoff:   maxBackoff,
+		mu:           new(sync.Mutex),
+	}
+}
+
+// Health returns current health of the stream.
+func (ss *StreamSupervisor) Health() StreamHealth {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.health
+}
+
+// IsAlive returns whether the stream is connected and not stalled at now.
+func (ss *StreamSupervisor) IsAlive(now time.Time) bool {
+	health := ss.Health()
+	if !health.Connected {
+		return false
+	}
+	if ss.stallTimeout <= 0 {
+		return true
+	}
+	last := health.LastMessage
+	if last.Before(health.ConnectedAt) {
+		last = health.ConnectedAt
+	}
+	return now.Sub(last) < ss.stallTimeout
+}
+
+// Serve connects the stream and keeps it alive until done is closed.
+func (ss *StreamSupervisor) Serve(done <-chan struct{}) {
+	for try := 0; ; try++ {
+		messages, stop, err := ss.open()
+		if err != nil {
+			ss.update(func(h *StreamHealth) { h.LastError = err.Error() })
+			log.Printf("%v stream: cannot connect: %v", ss.name, err)
+		} else {
+			ss.update(func(h *StreamHealth) {
+				h.Connected = true
+				h.ConnectedAt = time.Now()
+			})
+			received, reason := ss.receive(messages, done)
+			stop()
+			ss.update(func(h *StreamHealth) {
+				h.Connected = false
+				h.LastError = reason
+			})
+			if received {
+				try = 0
+			}
+			log.Printf("%v stream: disconnected: %v", ss.name, reason)
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(ss.backoffDuration(try)):
+		}
+		ss.update(func(h *StreamHealth) { h.Reconnects++ })
+	}
+}
+
+// backoffDuration returns the backoff after try failures. It is doubled for
+// each failure without overflow, and capped by maxBackoff if it is set.
+func (ss *StreamSupervisor) backoffDuration(try int) time.Duration {
+	wait := ss.backoff
+	for i := 0; i < try; i++ {
+		if wait > math.MaxInt64/2 {
+			break
+		}
+		wait *= 2
+	}
+	if ss.maxBackoff > 0 && wait > ss.maxBackoff {
+		wait = ss.maxBackoff
+	}
+	return wait
+}
+
+// receive handles messages until the stream should be reconnected.
+// It returns whether any message was received and the reason why it returned.
+func (ss *StreamSupervisor) receive(messages <-chan interface{}, done <-chan struct{}) (received bool, reason string) {
+	demux := twitter.NewSwitchDemux()
+	demux.Tweet = func(tweet *twitter.Tweet) {
+		ss.update(func(h *StreamHealth) {
+			h.LastTweet = time.Now()
+			h.Tweets++
+		})
+		ss.handleTweet(tweet)
+	}
+	demux.Warning = func(warning *twitter.StallWarning) {
+		ss.update(func(h *StreamHealth) { h.LastWarning = warning.Message })
+		log.Printf("%v stream: stall warning: %v (%d%% full)", ss.name, warning.Message, warning.PercentFull)
+	}
+	demux.StreamLimit = func(limit *twitter.StreamLimit) {
+		ss.update(func(h *StreamHealth) { h.Undelivered = limit.Track })
+	}
+	demux.StreamDisconnect = func(disconnect *twitter.StreamDisconnect) {
+		reason = fmt.Sprintf("disconnect notice %d: %v", disconnect.Code, disconnect.Reason)
+	}
+	demux.Other = func(message interface{}) {
+		if err, ok := message.(error); ok {
+			reason = err.Error()
+		}
+	}
+
+	var timeout <-chan time.Time
+	for {
+		if ss.stallTimeout > 0 {
+			timeout = time.After(ss.stallTimeout)
+		}
+
+		select {
+		case <-done:
+			return received, "stopped"
+		case <-timeout:
+			return received, fmt.Sprintf("stalled for %v", ss.stallTimeout)
+		case message, ok := <-messages:
+			if !ok {
+				if reason == "" {
+					reason = "stream closed"
+				}
+				return received, reason
+			}
+			received = true
+			ss.update(func(h *StreamHealth) { h.LastMessage = time.Now() })
+			demux.Handle(message)
+			if reason != "" {
+				return received, reason
+			}
+		}
+	}
+}
+
+// update updates health with f.
+func (ss *StreamSupervisor) update(f func(*StreamHealth)) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	f(&ss.health)
+}
+
+// StreamHealthServer checks the streams forever and logs dead streams.
+func StreamHealthServer(interval time.Duration, supervisors ...*StreamSupervisor) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, ss := range supervisors {
+			if !ss.IsAlive(now) {
+				health := ss.Health()
+				log.Printf("%v stream is dead: last message at %v, reconnects %d, last error %q",
+					ss.name, health.LastMessage.Format(time.RFC3339), health.Reconnects, health.LastError)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+)
+
+func TestStreamSupervisor_receive(t *testing.T) {
+	tests := []struct {
+		messages []interface{}
+		close    bool
+		received bool
+		reason   string
+		tweets   int64
+	}{
+		{
+			[]interface{}{&twitter.Tweet{}, &twitter.Tweet{}},
+			true,
+			true,
+			"stream closed",
+			2,
+		},
+		{
+			[]interface{}{
+				&twitter.Tweet{},
+				&twitter.StreamDisconnect{Code: 7, Reason: "admin logout"},
+				&twitter.Tweet{},
+			},
+			false,
+			true,
+			"disconnect notice 7: admin logout",
+			1,
+		},
+		{
+			[]interface{}{&twitter.StallWarning{Message: "falling behind"}},
+			false,
+			true,
+			"stalled for 10ms",
+			0,
+		},
+		{
+			[]interface{}{errors.New("connection reset")},
+			false,
+			true,
+			"connection reset",
+			0,
+		},
+		{
+			nil,
+			false,
+			false,
+			"stalled for 10ms",
+			0,
+		},
+	}
+
+	for idx, test := range tests {
+		ch := make(chan interface{}, len(test.messages))
+		for _, message := range test.messages {
+			ch <- message
+		}
+		if test.close {
+			close(ch)
+		}
+
+		var tweets int64
+		ss := NewStreamSupervisor("test", nil, func(*twitter.Tweet) { tweets++ },
+			10*time.Millisecond, time.Millisecond, time.Millisecond)
+		received, reason := ss.receive(ch, make(chan struct{}))
+		if received != test.received {
+			t.Errorf("[%d] received: expected %v, but got %v", idx, test.received, received)
+		}
+		if reason != test.reason {
+			t.Errorf("[%d] reason: expected %q, but got %q", idx, test.reason, reason)
+		}
+		if tweets != test.tweets || ss.Health().Tweets != test.tweets {
+			t.Errorf("[%d] tweets: expected %v, but got %v (%v)", idx, test.tweets, tweets, ss.Health().Tweets)
+		}
+	}
+}
+
+func TestStreamSupervisor_Serve(t *testing.T) {
+	var opened int
+	open := func() (<-chan interface{}, func(), error) {
+		opened++
+		if opened == 1 {
+			return nil, nil, errors.New("cannot connect")
+		}
+		ch := make(chan interface{}, 1)
+		ch <- &twitter.Tweet{}
+		close(ch)
+		return ch, func() {}, nil
+	}
+
+	done := make(chan struct{})
+	tweets := make(chan struct{}, 10)
+	ss := NewStreamSupervisor("test", open, func(*twitter.Tweet) { tweets <- struct{}{} },
+		time.Second, time.Millisecond, time.Millisecond)
+	go ss.Serve(done)
+
+	// reconnected after the connection error and the closed stream
+	for i := 0; i < 2; i++ {
+		select {
+		case <-tweets:
+		case <-time.After(time.Second):
+			t.Fatalf("[%d] stream was not reconnected", i)
+		}
+	}
+	close(done)
+
+	if ss.Health().Reconnects < 2 {
+		t.Errorf("expected reconnects >= 2, but got %v", ss.Health().Reconnects)
+	}
+}
+
+func TestStreamSupervisor_backoffDuration(t *testing.T) {
+	tests := []struct {
+		maxBackoff time.Duration
+		try        int
+		expected   time.Duration
+	}{
+		{time.Minute, 0, time.Second},
+		{time.Minute, 3, 8 * time.Second},
+		{time.Minute, 10, time.Minute},
+		{time.Minute, 100, time.Minute},
+		{0, 100, time.Second << 33},
+	}
+
+	for idx, test := range tests {
+		ss := NewStreamSupervisor("test", nil, nil, 0, time.Second, test.maxBackoff)
+		actual := ss.backoffDuration(test.try)
+		if actual != test.expected {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.expected, actual)
+		}
+	}
+}
+
+func TestStreamSupervisor_IsAlive(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		stallTimeout time.Duration
+		health       StreamHealth
+		alive        bool
+	}{
+		{
+			time.Minute,
+			StreamHealth{Connected: true, ConnectedAt: now.Add(-time.Hour), LastMessage: now.Add(-time.Second)},
+			true,
+		},
+		{
+			time.Minute,
+			StreamHealth{Connected: true, ConnectedAt: now.Add(-time.Hour), LastMessage: now.Add(-time.Hour)},
+			false,
+		},
+		{
+			time.Minute,
+			StreamHealth{Connected: true, ConnectedAt: now.Add(-time.Second)},
+			true,
+		},
+		{
+			0,
+			StreamHealth{Connected: true, ConnectedAt: now.Add(-time.Hour)},
+			true,
+		},
+		{
+			time.Minute,
+			StreamHealth{Connected: false, LastMessage: now},
+			false,
+		},
+	}
+
+	for idx, test := range tests {
+		ss := NewStreamSupervisor("test", nil, nil, test.stallTimeout, 0, 0)
+		ss.health = test.health
+		if alive := ss.IsAlive(now); alive != test.alive {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.alive, alive)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TimedMora is a mora on the beat grid. Times are in seconds.
+type TimedMora struct {
+	Mora     string  `json:"mora"`
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
+	Rhyme    bool    `json:"rhyme"`
+}
+
+// TimedLine is a line of Timeline.
+type TimedLine struct {
+	Text  string      `json:"text"`
+	Start float64     `json:"start"`
+	Morae []TimedMora `json:"morae"`
+}
+
+// Timeline is a lyric whose morae are placed on a 16th-note grid.
+type Timeline struct {
+	BPM          float64     `json:"bpm"`
+	BeatsPerLine int         `json:"beats_per_line"`
+	Lines        []TimedLine `json:"lines"`
+}
+
+// NewTimeline distributes morae of each line of lyric onto a 16th-note grid
+// of beatsPerLine beats at bpm. If a line has more morae than the grid, the
+// line takes multiple bars. Rhyming morae are marked by rap.RhymeMarks.
+func (rap *Rapper) NewTimeline(lyric Lyric, bpm float64, beatsPerLine int) (*Timeline, error) {
+	if bpm <= 0 || beatsPerLine <= 0 {
+		return nil, errors.New("bpm and beats per line must be positive")
+	}
+
+	sixteenth := 60.0 / bpm / 4
+	slotsPerLine := beatsPerLine * 4
+	marks := rap.RhymeMarks(lyric)
+
+	timeline := &Timeline{BPM: bpm, BeatsPerLine: beatsPerLine}
+	var slot int
+	for i, line := range lyric {
+		kana, ok := line.MoraKana()
+		if !ok || len(kana) != len(marks[i]) {
+			return nil, fmt.Errorf("line %d is unpronounceable: %v", i+1, line)
+		}
+
+		slots := slotsPerLine
+		for slots < len(kana) {
+			slots += slotsPerLine
+		}
+
+		timed := TimedLine{
+			Text:  line.String(),
+			Start: float64(slot) * sixteenth,
+			Morae: make([]TimedMora, len(kana)),
+		}
+		for j := range kana {
+			start := j * slots / len(kana)
+			end := (j + 1) * slots / len(kana)
+			timed.Morae[j] = TimedMora{
+				Mora:     kana[j],
+				Start:    float64(slot+start) * sixteenth,
+				Duration: float64(end-start) * sixteenth,
+				Rhyme:    marks[i][j],
+			}
+		}
+		timeline.Lines = append(timeline.Lines, timed)
+		slot += slots
+	}
+	return timeline, nil
+}
+
+// LRC returns the timeline in enhanced LRC format. Each mora has its own
+// timestamp and rhyming morae are surrounded by "*".
+func (tl *Timeline) LRC() string {
+	var b strings.Builder
+	for _, line := range tl.Lines {
+		b.WriteString("[" + lrcTime(line.Start) + "]")
+		for _, mora := range line.Morae {
+			b.WriteString("<" + lrcTime(mora.Start) + ">")
+			if mora.Rhyme {
+				b.WriteString("*" + mora.Mora + "*")
+			} else {
+				b.WriteString(mora.Mora)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// lrcTime formats sec as mm:ss.xx.
+func lrcTime(sec float64) string {
+	centi := int(sec*100 + 0.5)
+	return fmt.Sprintf("%02d:%02d.%02d", centi/6000, centi/100%60, centi%100)
+}
+
+// JSON returns the timeline in JSON format.
+func (tl *Timeline) JSON() ([]byte, error) {
+	return json.MarshalIndent(tl, "", "  ")
+}
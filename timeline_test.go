@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRapper_NewTimeline(t *testing.T) {
+	rapper := Rapper{weights: []Weight{{1.0, 1.0}, {1.0, 1.0}}}
+	lyric := Lyric{
+		Sentence{&Morph{"", "", "", "", "", "", "", "", "", "カンパイ"}},
+		Sentence{&Morph{"", "", "", "", "", "", "", "", "", "ダンサイ"}},
+	}
+
+	// 120 bpm: a 16th note is 0.125 sec, 1 beat per line has 4 slots.
+	timeline, err := rapper.NewTimeline(lyric, 120, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TimedLine{
+		{
+			"",
+			0,
+			[]TimedMora{
+				{"カ", 0, 0.125, false},
+				{"ン", 0.125, 0.125, false},
+				{"パ", 0.25, 0.125, true},
+				{"イ", 0.375, 0.125, true},
+			},
+		},
+		{
+			"",
+			0.5,
+			[]TimedMora{
+				{"ダ", 0.5, 0.125, false},
+				{"ン", 0.625, 0.125, false},
+				{"サ", 0.75, 0.125, true},
+				{"イ", 0.875, 0.125, true},
+			},
+		},
+	}
+	if len(timeline.Lines) != len(expected) {
+		t.Fatalf("expected %v lines, but got %v", len(expected), len(timeline.Lines))
+	}
+	for i, line := range timeline.Lines {
+		if line.Start != expected[i].Start || len(line.Morae) != len(expected[i].Morae) {
+			t.Errorf("[%d] expected %v, but got %v", i, expected[i], line)
+			continue
+		}
+		for j, mora := range line.Morae {
+			if mora != expected[i].Morae[j] {
+				t.Errorf("[%d, %d] expected %v, but got %v", i, j, expected[i].Morae[j], mora)
+			}
+		}
+	}
+
+	lrc := "[00:00.00]<00:00.00>カ<00:00.13>ン<00:00.25>*パ*<00:00.38>*イ*\n" +
+		"[00:00.50]<00:00.50>ダ<00:00.63>ン<00:00.75>*サ*<00:00.88>*イ*\n"
+	if timeline.LRC() != lrc {
+		t.Errorf("expected\n%v, but got\n%v", lrc, timeline.LRC())
+	}
+}
+
+func TestRapper_NewTimeline_long(t *testing.T) {
+	rapper := Rapper{}
+	lyric := Lyric{
+		Sentence{&Morph{"", "", "", "", "", "", "", "", "", "アイウエオ"}},
+		Sentence{&Morph{"", "", "", "", "", "", "", "", "", "カ"}},
+	}
+
+	timeline, err := rapper.NewTimeline(lyric, 60, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first line takes 2 bars, and the second line has a whole bar.
+	if d := timeline.Lines[0].Morae[0].Duration; d != 0.25 {
+		t.Errorf("expected 0.25, but got %v", d)
+	}
+	if start := timeline.Lines[1].Start; start != 2.0 {
+		t.Errorf("expected 2.0, but got %v", start)
+	}
+	if d := timeline.Lines[1].Morae[0].Duration; d != 1.0 {
+		t.Errorf("expected 1.0, but got %v", d)
+	}
+
+	if _, err := rapper.NewTimeline(Lyric{Sentence{&Morph{Surface: "ｗ"}}}, 60, 1); err == nil {
+		t.Errorf("expected error for unpronounceable line")
+	}
+}
+
+func TestRunTimeline(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := runTimeline([]string{"-bpm", "120", "-format", "json"}, strings.NewReader("まじか\n"), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"mora": "マ"`) {
+		t.Errorf("unexpected output: %v", out.String())
+	}
+}
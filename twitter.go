@@ -3,31 +3,56 @@ package main
 import (
 	"fmt"
 	"html"
+	"log"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/dghubble/go-twitter/twitter"
 	"github.com/dghubble/oauth1"
-	"github.com/ikawaha/kagome/tokenizer"
 )
 
-// NewTwitterClient returns new twitter client.
-func NewTwitterClient() *twitter.Client {
+// NewTwitterClient returns new twitter client. If recorder is not nil,
+// stream messages are recorded by it.
+func NewTwitterClient(recorder *TweetRecorder) *twitter.Client {
 	config := oauth1.NewConfig(os.Getenv("CONSUMER_KEY"), os.Getenv("CONSUMER_SECRET"))
 	token := oauth1.NewToken(os.Getenv("ACCESS_TOKEN"), os.Getenv("ACCESS_TOKEN_SECRET"))
 	httpClient := config.Client(oauth1.NoContext, token)
+	if recorder != nil {
+		httpClient.Transport = recorder.Transport(httpClient.Transport)
+	}
 	return twitter.NewClient(httpClient)
 }
 
 // ExtractTweet extract valid text and send if to chTweets.
 func ExtractTweet(tweet *twitter.Tweet) {
-	if !isLearnableTweet(tweet) {
+	extractTweet(tweet, false)
+}
+
+// ReplayTweet is ExtractTweet which blocks not to lose replayed tweets.
+func ReplayTweet(tweet *twitter.Tweet) {
+	extractTweet(tweet, true)
+}
+
+// extractTweet sends the text of tweet to chTweets if it is learnable. If
+// block is false, the text is dropped when chTweets is full.
+func extractTweet(tweet *twitter.Tweet, block bool) {
+	learnable := tweetFilter.Accept(tweet)
+	if tweetRecorder != nil {
+		if err := tweetRecorder.Decide(tweet.IDStr, learnable); err != nil {
+			log.Println(err)
+		}
+	}
+	if !learnable {
 		return
 	}
 
 	text := html.UnescapeString(tweet.Text)
 
+	if block {
+		ChTweets <- text
+		return
+	}
 	// avoid blocking
 	select {
 	case ChTweets <- text:
@@ -35,44 +60,43 @@ func ExtractTweet(tweet *twitter.Tweet) {
 	}
 }
 
-// isLearnableTweet returns the tweet is valid.
-// Filter spams by this function.
-func isLearnableTweet(tweet *twitter.Tweet) bool {
-	return true && // dummy for easy comment out
-		tweet.Lang == "ja" && // Japanese lang tweet
-		// tweet.RetweetedStatus == nil && // not retweet
-		// tweet.QuotedStatus == nil && // not retweet
-		tweet.InReplyToScreenName == "" && // not reply
-		len(tweet.Entities.Hashtags) == 0 && // no hashtags
-		len(tweet.Entities.Media) == 0 && // no media
-		len(tweet.Entities.Urls) == 0 && // no urls
-		len(tweet.Entities.UserMentions) == 0 && // no mentions
-		tweet.User.FriendsCount > 10 && // has some friends
-		tweet.User.FollowersCount > 10 && // has some followers
-		true // dummy for easy comment out
+// ServeReply queues a reply to tweet.
+func ServeReply(tweet *twitter.Tweet) {
+	if !replyGuard.IsReplyable(tweet) {
+		return
+	}
+	if !replyGuard.Push(tweet) {
+		log.Println("reply queue is full: drop", tweet.IDStr)
+	}
 }
 
-// ServeReply serves a reply.
-func ServeReply(tweet *twitter.Tweet) {
-	t := tokenizer.New()
-	sentence := analyzeText(&t, tweet.Text)
+// reply posts a reply to tweet.
+func reply(tweet *twitter.Tweet) {
+	sentence := analyzer.Analyze(tweet.Text)
 	lyric := lyricStorage.ContinueLyric(rapper, sentence)
+	if lyric != nil && !moderator.Accept(lyric) {
+		lyric = nil
+	}
 
 	header := "@" + tweet.User.ScreenName
 
 	var body string
+	var score float64
 	if lyric == nil {
 		body = "準備中です(｀･ω･´)"
 	} else {
-		body = lyric.String()
+		body = rapper.Render(lyric)
+		score = rapper.Distance(sentence, lyric[0])
 	}
 
-	TwiClient.Statuses.Update(
-		header+"\n"+body,
-		&twitter.StatusUpdateParams{
+	outbox.Send(&Post{
+		Text: header + "\n" + body,
+		Params: &twitter.StatusUpdateParams{
 			InReplyToStatusID: tweet.ID,
 		},
-	)
+		Lyric: lyric,
+		Score: score,
+	})
 }
 
 // LaunchRegularTweetServer post tweet.
@@ -81,18 +105,31 @@ func LaunchRegularTweetServer() error {
 	if err != nil {
 		return fmt.Errorf("invalid REGULAR_TWEET_MINUTES: %w", err)
 	}
+	rank, err := envBoolDefault("RANK_REGULAR_TWEETS", false)
+	if err != nil {
+		return err
+	}
 
 	go func() {
 		ticker := time.NewTicker(time.Duration(duration) * time.Minute)
 		<-markov.Ready
 		for {
 			<-ticker.C
-			lyric := lyricStorage.Pop()
+			var lyric Lyric
+			if rank {
+				lyric = lyricStorage.PopBest(rapper)
+			} else {
+				lyric = lyricStorage.Pop()
+			}
 			if lyric == nil {
 				continue
 			}
 
-			TwiClient.Statuses.Update(lyric.String(), nil)
+			outbox.Send(&Post{
+				Text:  rapper.Render(lyric),
+				Lyric: lyric,
+				Score: rapper.Score(lyric),
+			})
 		}
 	}()
 	return nil
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ikawaha/kagome/tokenizer"
+)
+
+// UserWord is a word of UserDictionary.
+type UserWord struct {
+	Surface       string
+	PartOfSpeech  string
+	Reading       string
+	Pronunciation string
+}
+
+// UserDictionary has words which the system dictionary does not know, such
+// as slang, artist names and net words.
+type UserDictionary struct {
+	words map[string]*UserWord
+	dic   tokenizer.UserDic
+}
+
+// LoadUserDictionary reads UserDictionary from path.
+func LoadUserDictionary(path string) (*UserDictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load user dictionary: %w", err)
+	}
+	defer f.Close()
+
+	ud, err := ReadUserDictionary(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load user dictionary: %v: %w", path, err)
+	}
+	return ud, nil
+}
+
+// ReadUserDictionary reads UserDictionary from CSV whose columns are surface,
+// part of speech, reading and pronunciation. Reading and pronunciation may be
+// written in hiragana. If pronunciation is empty, reading is used instead.
+// Lines which begin with "#" are ignored.
+func ReadUserDictionary(r io.Reader) (*UserDictionary, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	ud := &UserDictionary{words: map[string]*UserWord{}}
+	var records tokenizer.UserDicRecords
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		word := &UserWord{
+			Surface:       record[0],
+			PartOfSpeech:  record[1],
+			Reading:       toKatakana(record[2]),
+			Pronunciation: toKatakana(record[3]),
+		}
+		if word.Pronunciation == "" {
+			word.Pronunciation = word.Reading
+		}
+		if word.Surface == "" || word.PartOfSpeech == "" {
+			return nil, fmt.Errorf("record %d: surface and part of speech are required", n)
+		}
+		if !isPronunciation(word.Pronunciation) {
+			return nil, fmt.Errorf("record %d: cannot pronounce %q", n, word.Pronunciation)
+		}
+		if _, ok := ud.words[word.Surface]; ok {
+			return nil, fmt.Errorf("record %d: duplicated word %q", n, word.Surface)
+		}
+
+		ud.words[word.Surface] = word
+		records = append(records, tokenizer.UserDicRecord{
+			Text:   word.Surface,
+			Tokens: []string{word.Surface},
+			Yomi:   []string{word.Reading},
+			Pos:    word.PartOfSpeech,
+		})
+	}
+
+	dic, err := records.NewUserDic()
+	if err != nil {
+		return nil, err
+	}
+	ud.dic = dic
+	return ud, nil
+}
+
+// Len returns the number of words.
+func (ud *UserDictionary) Len() int {
+	return len(ud.words)
+}
+
+// Apply sets properties of the user words to morphs in sentence.
+func (ud *UserDictionary) Apply(sentence Sentence) {
+	for _, morph := range sentence {
+		word, ok := ud.words[morph.Surface]
+		if !ok {
+			continue
+		}
+		morph.PartOfSpeech = word.PartOfSpeech
+		morph.Reading = word.Reading
+		morph.Pronunciation = word.Pronunciation
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadUserDictionary(t *testing.T) {
+	tests := []struct {
+		csv string
+		len int
+		ok  bool
+	}{
+		{"鬼滅の刃,名詞,きめつのやいば,キメツノヤイバ\n", 1, true},
+		{"# comment\n鬼滅の刃,名詞,キメツノヤイバ,\nぴえん,感動詞,ピエン,ピエン\n", 2, true},
+		{"", 0, true},
+		{"鬼滅の刃,名詞,キメツノヤイバ\n", 0, false},
+		{",名詞,キメツノヤイバ,キメツノヤイバ\n", 0, false},
+		{"鬼滅の刃,名詞,鬼滅の刃,\n", 0, false},
+		{"ぴえん,感動詞,ピエン,\nぴえん,名詞,ピエン,\n", 0, false},
+	}
+
+	for idx, test := range tests {
+		ud, err := ReadUserDictionary(strings.NewReader(test.csv))
+		if (err == nil) != test.ok {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.ok, err)
+			continue
+		}
+		if err == nil && ud.Len() != test.len {
+			t.Errorf("[%d] expected %v, but got %v", idx, test.len, ud.Len())
+		}
+	}
+}
+
+func TestAnalyzer_Analyze(t *testing.T) {
+	dir, err := ioutil.TempDir("", "userdic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "userdic.csv")
+
+	if err := ioutil.WriteFile(path, []byte("鬼滅の刃,名詞,きめつのやいば,キメツノヤイバ\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	analyzer, err := NewAnalyzer("ipa", path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sentence := trimBOSEOS(analyzer.Analyze("鬼滅の刃"))
+	if len(sentence) != 1 {
+		t.Fatalf("expected 1 morph, but got %v", sentence)
+	}
+	expected := &Morph{"鬼滅の刃", "名詞", "*", "*", "*", "*", "*", "鬼滅の刃", "キメツノヤイバ", "キメツノヤイバ"}
+	if !reflect.DeepEqual(expected, sentence[0]) {
+		t.Errorf("expected %v, but got %v", expected, sentence[0])
+	}
+	morae, ok := sentence.Morae()
+	if !ok || morae.Katakana() != "キメツノヤイバ" {
+		t.Errorf("expected %v, but got %v", "キメツノヤイバ", morae.Katakana())
+	}
+
+	// hot reload
+	if reloaded, err := analyzer.Reload(); reloaded || err != nil {
+		t.Errorf("expected not to be reloaded, but got %v, %v", reloaded, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("ぴえん,感動詞,ピエン,ピエーン\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := analyzer.Reload(); !reloaded || err != nil {
+		t.Errorf("expected to be reloaded, but got %v, %v", reloaded, err)
+	}
+	if p := analyzer.Analyze("ぴえん")[1].Pronunciation; p != "ピエーン" {
+		t.Errorf("expected %v, but got %v", "ピエーン", p)
+	}
+
+	// broken dictionary keeps the current one
+	if err := ioutil.WriteFile(path, []byte("broken\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := analyzer.Reload(); err == nil {
+		t.Error("expected an error, but got nil")
+	}
+	if p := analyzer.Analyze("ぴえん")[1].Pronunciation; p != "ピエーン" {
+		t.Errorf("expected %v, but got %v", "ピエーン", p)
+	}
+}